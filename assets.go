@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directories under AssetsDir that downloaded images and file attachments
+// are written to. They are also the URL prefixes the assets are served from.
+const (
+	imagesDir = "docs-images"
+	filesDir  = "docs-files"
+)
+
+// Tracks the assets referenced by the current export so that stale ones
+// can be removed once the export is done
+var assets struct {
+	referenced map[string]int // references by path including the assets directory
+
+	// Assets referenced by the page being rendered, relative to AssetsDir
+	page []string
+}
+
+// A downloaded asset
+type asset struct {
+	Path string // relative to AssetsDir, slash separated
+	Size int64
+
+	// Dimensions of images, only set when image optimization is enabled
+	Width, Height         int
+	OrigWidth, OrigHeight int
+}
+
+// URL the asset is served from
+func (a asset) URL() string {
+	segments := strings.Split(a.Path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// Record an asset (path relative to AssetsDir) as used by this export
+func markAssetReferenced(rel string) {
+	if assets.referenced == nil {
+		assets.referenced = make(map[string]int)
+	}
+	assets.referenced[assetKey(rel)]++
+	assets.page = append(assets.page, filepath.ToSlash(rel))
+}
+
+// Drop one reference to an asset marked by the page being rendered, it is
+// removed by pruneAssets when nothing else references it
+func unmarkAssetReferenced(rel string) {
+	assets.referenced[assetKey(rel)]--
+	for i, p := range assets.page {
+		if p == filepath.ToSlash(rel) {
+			assets.page = append(assets.page[:i], assets.page[i+1:]...)
+			break
+		}
+	}
+}
+
+func assetKey(rel string) string {
+	return filepath.ToSlash(filepath.Join(conf.AssetsDir, filepath.FromSlash(rel)))
+}
+
+// Download an image into AssetsDir/docs-images. Images are named after the
+// SHA-256 of their content, so unchanged images keep the same name between
+// exports and an image that is already present is not written again.
+func downloadImage(url string) (asset, error) {
+	return downloadAsset(url, imagesDir, "")
+}
+
+// Download a file attachment into AssetsDir/docs-files, keeping its original
+// name inside a directory named after the content hash
+func downloadFile(url string, name string) (asset, error) {
+	if name == "" {
+		name = fileNameFromURL(url)
+	}
+	return downloadAsset(url, filesDir, sanitizeFileName(name))
+}
+
+// Download url into subdir of AssetsDir. With an empty name the file is named
+// after its content hash, otherwise it is stored as <hash>/<name>. Failed
+// requests are retried with an exponential backoff.
+func downloadAsset(url string, subdir string, name string) (asset, error) {
+	var lastErr error
+	for attempt := 0; attempt <= conf.AssetRetries; attempt++ {
+		if attempt > 0 {
+			wait := time.Duration(1<<(attempt-1)) * time.Second
+			var retryErr *retryableError
+			if errors.As(lastErr, &retryErr) && retryErr.after > wait {
+				wait = retryErr.after
+			}
+			stats.AssetRetries++
+			slog.Warn("retrying asset download", "url", url, "wait", wait, "attempt", attempt, "retries", conf.AssetRetries, "error", lastErr)
+			time.Sleep(wait)
+		}
+
+		a, err := fetchAsset(url, subdir, name)
+		if err == nil {
+			stats.AssetsDownloaded++
+			emit(eventAssetDownloaded)
+			stats.AssetBytes += a.Size
+			return a, nil
+		}
+		lastErr = err
+
+		var retryErr *retryableError
+		if !errors.As(err, &retryErr) {
+			break
+		}
+	}
+	return asset{}, lastErr
+}
+
+// An error after which the download may succeed when tried again
+type retryableError struct {
+	err   error
+	after time.Duration // minimum wait requested by the server, if any
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// Make a single attempt at downloading an asset, writing it atomically
+func fetchAsset(url string, subdir string, name string) (asset, error) {
+	dir := filepath.Join(conf.AssetsDir, subdir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return asset{}, err
+	}
+
+	// Make the HTTP request to download the asset
+	client := &http.Client{Timeout: conf.AssetTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return asset{}, &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+
+	// Check if the request was successful
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("failed to download asset: status code %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return asset{}, &retryableError{err: err, after: retryAfter(resp)}
+		}
+		return asset{}, err
+	}
+
+	// Refuse oversized assets up front when the server tells us the size,
+	// the body is limited below in case it doesn't
+	if conf.MaxAssetSize > 0 && resp.ContentLength > conf.MaxAssetSize {
+		return asset{}, fmt.Errorf("asset is %s, larger than the limit of %s", humanSize(resp.ContentLength), humanSize(conf.MaxAssetSize))
+	}
+
+	body := bufio.NewReaderSize(resp.Body, 512)
+	ext := ""
+	if name == "" {
+		sniff, _ := body.Peek(512)
+		ext = assetExtension(resp.Header.Get("Content-Type"), sniff, url)
+		if ext == "" {
+			return asset{}, fmt.Errorf("failed to determine file extension for content type: %s", resp.Header.Get("Content-Type"))
+		}
+	}
+
+	// Stream into a temp file in the target directory while hashing, the
+	// final name is only known once the whole body has been read
+	tmp, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return asset{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	var src io.Reader = body
+	if conf.MaxAssetSize > 0 {
+		src = io.LimitReader(body, conf.MaxAssetSize+1)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if err != nil {
+		tmp.Close()
+		return asset{}, &retryableError{err: err}
+	}
+	if err := tmp.Close(); err != nil {
+		return asset{}, err
+	}
+	if conf.MaxAssetSize > 0 && size > conf.MaxAssetSize {
+		return asset{}, fmt.Errorf("asset is larger than the limit of %s", humanSize(conf.MaxAssetSize))
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))[:16]
+	rel := path.Join(subdir, sum+ext)
+	if name != "" {
+		rel = path.Join(subdir, sum, name)
+	}
+	dest := filepath.Join(conf.AssetsDir, filepath.FromSlash(rel))
+
+	// Reuse the existing file if the same content was downloaded before
+	if _, err := os.Stat(dest); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+			return asset{}, err
+		}
+		if err := os.Rename(tmp.Name(), dest); err != nil {
+			return asset{}, err
+		}
+	}
+
+	markAssetReferenced(rel)
+	return asset{Path: rel, Size: size}, nil
+}
+
+// Extensions to use for common content types, mime.ExtensionsByType returns
+// them in alphabetical order which would give e.g. ".jfif" for JPEG images
+var preferredExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/svg+xml":   ".svg",
+	"image/bmp":       ".bmp",
+	"image/tiff":      ".tiff",
+	"image/avif":      ".avif",
+	"application/pdf": ".pdf",
+	"video/mp4":       ".mp4",
+	"audio/mpeg":      ".mp3",
+}
+
+// Work out the file extension of an asset from its Content-Type header,
+// falling back to sniffing the first bytes of the body and then to the
+// extension in the URL path
+func assetExtension(contentType string, sniff []byte, rawURL string) string {
+	if ext := extensionForType(contentType); ext != "" {
+		return ext
+	}
+	if len(sniff) > 0 {
+		if ext := extensionForType(http.DetectContentType(sniff)); ext != "" {
+			return ext
+		}
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		if ext := path.Ext(u.Path); ext != "" && len(ext) <= 6 {
+			return strings.ToLower(ext)
+		}
+	}
+	return ""
+}
+
+func extensionForType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "application/octet-stream" {
+		return ""
+	}
+	if ext, ok := preferredExtensions[mediaType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// Parse the Retry-After header, only the delay-seconds form is supported
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Derive a file name from the last path segment of a URL
+func fileNameFromURL(rawURL string) string {
+	name := "file"
+	if u, err := url.Parse(rawURL); err == nil {
+		if base := path.Base(u.Path); base != "." && base != "/" {
+			name = base
+		}
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return sanitizeFileName(name)
+}
+
+// Strip anything that would let a file name escape its directory
+func sanitizeFileName(name string) string {
+	name = strings.NewReplacer("/", "-", `\`, "-").Replace(name)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		name = "file"
+	}
+	return name
+}
+
+// Format a byte count for display, e.g. "1.2 MB"
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Remove the assets listed by the manifests of previous exports that no
+// page of this export references anymore, and the directories left empty.
+// Assets downloaded by other exports into the same directory aren't listed,
+// so they are kept. Nothing is removed if any download or page failed, since
+// the files of the failed assets and those linked from kept pages can't be
+// told apart from stale ones.
+func pruneAssets(assetsDir string, listed []string) {
+	if stats.AssetsFailed > 0 {
+		slog.Warn("skipping asset cleanup, some assets failed to download", "failed", stats.AssetsFailed)
+		return
+	}
+	if stats.PagesFailed > 0 {
+		slog.Warn("skipping asset cleanup, some pages failed to export", "failed", stats.PagesFailed)
+		return
+	}
+
+	// Assets are referenced by where they were downloaded to, which differs
+	// from assetsDir on dry runs
+	downloadDir := output.AssetsDir(assetsDir)
+
+	sort.Strings(listed)
+	for i, rel := range listed {
+		if i > 0 && rel == listed[i-1] || assets.referenced[filepath.ToSlash(filepath.Join(downloadDir, filepath.FromSlash(rel)))] > 0 {
+			continue
+		}
+		if err := output.Remove(filepath.Join(assetsDir, filepath.FromSlash(rel))); err != nil {
+			if !os.IsNotExist(err) {
+				slog.Error("failed to remove stale asset", "path", rel, "error", err)
+			}
+			continue
+		}
+		slog.Info("removed stale asset", "path", rel)
+
+		// Files are stored in a directory named after their hash, which
+		// goes once empty. The docs-images and docs-files directories stay.
+		subdir, dir, _ := strings.Cut(path.Dir(rel), "/")
+		removeEmptyDirs(filepath.Join(assetsDir, subdir), dir)
+	}
+}
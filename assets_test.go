@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPruneAssets(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"docs-images/kept.png",
+		"docs-images/stale.png",
+		"docs-images/other-export.png",
+		"docs-files/0123456789abcdef/stale.pdf",
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats = newRunStats()
+	conf.AssetsDir = dir
+	assets.referenced = nil
+	markAssetReferenced("docs-images/kept.png")
+	defer func() { assets.referenced, assets.page = nil, nil }()
+
+	pruneAssets(dir, []string{
+		"docs-images/kept.png",
+		"docs-images/stale.png",
+		"docs-images/stale.png",
+		"docs-files/0123456789abcdef/stale.pdf",
+		"docs-images/missing.png",
+	})
+
+	want := map[string]bool{
+		"docs-images/kept.png":                  true,
+		"docs-images/stale.png":                 false,
+		"docs-images/other-export.png":          true,
+		"docs-files/0123456789abcdef/stale.pdf": false,
+		"docs-files/0123456789abcdef":           false,
+		"docs-files":                            true,
+	}
+	for f, exists := range want {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f)))
+		if got := err == nil; got != exists {
+			t.Errorf("%s exists = %v, want %v", f, got, exists)
+		}
+	}
+}
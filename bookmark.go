@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// How long fetched bookmark metadata is reused before it is fetched again
+const bookmarkCacheTTL = 7 * 24 * time.Hour
+
+// Metadata of a bookmarked page, taken from its OpenGraph tags
+type bookmarkMeta struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Favicon     string    `json:"favicon,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// Bookmark metadata persisted in CacheDir between runs, keyed by URL
+var bookmarkCache struct {
+	loaded  bool
+	dirty   bool
+	entries map[string]bookmarkMeta
+}
+
+func bookmarkCachePath() string {
+	return filepath.Join(conf.CacheDir, "bookmarks.json")
+}
+
+func loadBookmarkCache() {
+	if bookmarkCache.loaded {
+		return
+	}
+	bookmarkCache.loaded = true
+	bookmarkCache.entries = make(map[string]bookmarkMeta)
+
+	data, err := os.ReadFile(bookmarkCachePath())
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &bookmarkCache.entries); err != nil {
+		slog.Warn("ignoring unreadable bookmark cache", "error", err)
+		bookmarkCache.entries = make(map[string]bookmarkMeta)
+	}
+}
+
+// Write the bookmark cache back to CacheDir if anything was fetched
+func saveBookmarkCache() {
+	if !bookmarkCache.dirty {
+		return
+	}
+	data, err := json.MarshalIndent(bookmarkCache.entries, "", "  ")
+	if err != nil {
+		slog.Error("failed to encode bookmark cache", "error", err)
+		return
+	}
+	if err := os.MkdirAll(conf.CacheDir, os.ModePerm); err != nil {
+		slog.Error("failed to create cache directory", "path", conf.CacheDir, "error", err)
+		return
+	}
+	if err := os.WriteFile(bookmarkCachePath(), data, 0644); err != nil {
+		slog.Error("failed to write bookmark cache", "error", err)
+	}
+}
+
+// Get the metadata of a bookmarked page, from the cache when it is recent.
+// Failed fetches are cached too so unreachable sites aren't retried on
+// every run.
+func getBookmarkMeta(pageURL string) bookmarkMeta {
+	loadBookmarkCache()
+	if meta, ok := bookmarkCache.entries[pageURL]; ok && time.Since(meta.FetchedAt) < bookmarkCacheTTL {
+		return meta
+	}
+
+	meta, err := fetchBookmarkMeta(pageURL)
+	if err != nil {
+		pageLog.Warn("failed to fetch bookmark metadata", "url", pageURL, "error", err)
+	}
+	meta.FetchedAt = time.Now()
+	bookmarkCache.entries[pageURL] = meta
+	bookmarkCache.dirty = true
+	return meta
+}
+
+var (
+	titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	tagPattern   = regexp.MustCompile(`(?is)<(meta|link)\s[^>]*>`)
+	attrPattern  = regexp.MustCompile(`(?s)([\w:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// Fetch a page and read its title, description and favicon from the head
+func fetchBookmarkMeta(pageURL string) (bookmarkMeta, error) {
+	var meta bookmarkMeta
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return meta, err
+	}
+	req.Header.Set("User-Agent", "nosaurus-go (+https://github.com/rafayhingoro/nosaurus-go)")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return meta, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return meta, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	// The head is all we need, don't read arbitrarily large pages
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return meta, err
+	}
+	doc := string(body)
+	if end := strings.Index(strings.ToLower(doc), "</head>"); end >= 0 {
+		doc = doc[:end]
+	}
+
+	if m := titlePattern.FindStringSubmatch(doc); m != nil {
+		meta.Title = cleanText(m[1])
+	}
+
+	favicon := ""
+	for _, tag := range tagPattern.FindAllStringSubmatch(doc, -1) {
+		attrs := parseAttrs(tag[0])
+		if strings.EqualFold(tag[1], "link") {
+			rel := strings.ToLower(attrs["rel"])
+			if favicon == "" && (rel == "icon" || rel == "shortcut icon") {
+				favicon = attrs["href"]
+			}
+			continue
+		}
+
+		key := strings.ToLower(attrs["property"])
+		if key == "" {
+			key = strings.ToLower(attrs["name"])
+		}
+		content := cleanText(attrs["content"])
+		switch key {
+		case "og:title":
+			meta.Title = content
+		case "og:description":
+			meta.Description = content
+		case "description":
+			if meta.Description == "" {
+				meta.Description = content
+			}
+		}
+	}
+
+	if favicon == "" {
+		favicon = "/favicon.ico"
+	}
+	if base, err := url.Parse(pageURL); err == nil {
+		if ref, err := url.Parse(favicon); err == nil {
+			meta.Favicon = base.ResolveReference(ref).String()
+		}
+	}
+
+	return meta, nil
+}
+
+func parseAttrs(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrPattern.FindAllStringSubmatch(tag, -1) {
+		attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+	}
+	return attrs
+}
+
+func cleanText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// Escape text for use in MDX, where braces start JSX expressions
+var mdxEscaper = strings.NewReplacer(`&`, "&amp;", `"`, "&quot;", `<`, "&lt;", `>`, "&gt;", `{`, "&#123;", `}`, "&#125;")
+
+// Escape the text of a Markdown link, where brackets end the text and MDX
+// reads tags and JSX expressions
+var linkTextEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, `<`, "&lt;", `{`, "&#123;", `}`, "&#125;")
+
+// Render a bookmark as a link, or as a card with the target's title,
+// description and favicon when BookmarkCards is enabled. Empty captions fall
+// back to the page title and then to the URL.
+func renderBookmark(b *Bookmark) string {
+	caption := ""
+	for _, t := range b.Caption {
+		caption += t.PlainText
+	}
+
+	var meta bookmarkMeta
+	if conf.BookmarkCards || caption == "" {
+		meta = getBookmarkMeta(b.URL)
+	}
+
+	title := caption
+	if title == "" {
+		title = meta.Title
+	}
+	if title == "" {
+		title = b.URL
+	}
+
+	if !conf.BookmarkCards {
+		return fmt.Sprintf("[%s](%s)  \n", linkTextEscaper.Replace(title), b.URL)
+	}
+
+	var card strings.Builder
+	card.WriteString(fmt.Sprintf(`<a className="bookmark-card" href="%s">`, mdxEscaper.Replace(b.URL)))
+	if meta.Favicon != "" {
+		card.WriteString(fmt.Sprintf(`<img className="bookmark-card__favicon" src="%s" alt="" width="16" height="16" />`, mdxEscaper.Replace(meta.Favicon)))
+	}
+	card.WriteString(fmt.Sprintf(`<strong className="bookmark-card__title">%s</strong>`, mdxEscaper.Replace(title)))
+	if meta.Description != "" {
+		card.WriteString(fmt.Sprintf(`<span className="bookmark-card__description">%s</span>`, mdxEscaper.Replace(meta.Description)))
+	}
+	card.WriteString(fmt.Sprintf(`<span className="bookmark-card__url">%s</span>`, mdxEscaper.Replace(b.URL)))
+	card.WriteString("</a>\n\n")
+	return card.String()
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestRenderBookmarkLink(t *testing.T) {
+	conf.BookmarkCards = false
+	tests := []struct {
+		caption string
+		want    string
+	}{
+		{"Docs", "[Docs](https://example.com)  \n"},
+		{"[beta] <Setup> {v2}", `[\[beta\] &lt;Setup> &#123;v2&#125;](https://example.com)  ` + "\n"},
+		{`C:\path`, `[C:\\path](https://example.com)  ` + "\n"},
+	}
+
+	for _, tt := range tests {
+		b := &Bookmark{URL: "https://example.com", Caption: []RichText{{PlainText: tt.caption}}}
+		if got := renderBookmark(b); got != tt.want {
+			t.Errorf("renderBookmark(%q) = %q, want %q", tt.caption, got, tt.want)
+		}
+	}
+}
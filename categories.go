@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// Contents of a _category_.json file
+type categoryFile struct {
+	Label       string                 `json:"label"`
+	Position    float64                `json:"position"`
+	Collapsible *bool                  `json:"collapsible,omitempty"`
+	Collapsed   *bool                  `json:"collapsed,omitempty"`
+	ClassName   string                 `json:"className,omitempty"`
+	Link        *categoryLink          `json:"link,omitempty"`
+	CustomProps map[string]interface{} `json:"customProps,omitempty"`
+}
+
+type categoryLink struct {
+	Type        string `json:"type"`
+	ID          string `json:"id,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Build the category of a directory node. Directories of pages link to the
+// page's doc, plain child_page directories get a generated index, either
+// can be changed with a property mapped to category_link.
+func buildCategory(n *docNode) categoryFile {
+	category := categoryFile{
+		Label:    n.Title,
+		Position: n.Position,
+	}
+	category.Collapsed, category.Collapsible = categoryFlags(n)
+	if category.Collapsed == nil && !conf.SidebarCollapsed {
+		expanded := false
+		category.Collapsed = &expanded
+	}
+
+	linkType := "generated-index"
+	if n.Page != nil {
+		linkType = "doc"
+	}
+
+	description := ""
+	if n.Page != nil {
+		page := *n.Page
+		if prop, ok := findProperty(page, roleDescription); ok {
+			description = prop.Text()
+		}
+		if prop, ok := findProperty(page, roleClassName); ok {
+			category.ClassName = prop.Text()
+		}
+		if prop, ok := findProperty(page, roleCategoryLink); ok {
+			if value := strings.ToLower(strings.TrimSpace(prop.Text())); value != "" {
+				linkType = value
+			}
+		}
+	}
+
+	switch linkType {
+	case "doc":
+		if n.Page != nil {
+			category.Link = &categoryLink{Type: "doc", ID: n.docID()}
+		}
+	case "generated-index":
+		category.Link = &categoryLink{Type: "generated-index", Title: n.Title, Description: description}
+	}
+
+	if description != "" {
+		category.CustomProps = map[string]interface{}{"description": description}
+	}
+
+	return category
+}
+
+// Write the _category_.json of a directory node
+func writeCategory(outputDir string, n *docNode) error {
+	data, err := json.MarshalIndent(buildCategory(n), "", "\t")
+	if err != nil {
+		return err
+	}
+	return output.WriteFile(filepath.Join(outputDir, n.dirPath(), "_category_.json"), data)
+}
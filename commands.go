@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: nosaurus-go [command] [flags]
+
+Commands:
+  export    export all roots (default)
+  sync      export only the pages edited since the previous export
+  watch     sync, then sync again whenever pages are edited in Notion
+  validate  check that all roots can be reached and report unsupported blocks, without writing
+  clean     remove the files written by previous exports
+  inspect   print the block tree of a page as JSON
+
+Run nosaurus-go <command> -h for the flags of a command.
+
+Exit codes: 0 on success, 1 when pages failed to export or on errors, 2 on
+invalid flags, 3 when -strict-threshold is exceeded.
+`
+
+// Positional arguments of commands, for their usage
+var commandArgs = map[string]string{
+	"inspect": " <page or block ID or URL>",
+}
+
+func main() {
+	command, args := "export", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "export":
+		runExport(configure(command, args), false)
+	case "sync":
+		runExport(configure(command, args), true)
+	case "watch":
+		runWatch(configure(command, args))
+	case "validate":
+		runValidate(configure(command, args))
+	case "clean":
+		runClean(configure(command, args))
+	case "inspect":
+		runInspect(configure(command, args))
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+func requireToken(s *settings) {
+	if s.Token == "" {
+		fatal("Notion API token is required, use -t or NOTION_TOKEN")
+	}
+}
+
+func requireRoots(s *settings) {
+	if len(s.Roots) == 0 {
+		fatal("root ID is required, use -r or -root")
+	}
+}
+
+// Discover every root, pages reachable from several roots are exported with
+// the first one
+func discoverRoots(s *settings) error {
+	for _, r := range s.Roots {
+		if err := r.discover(s.Token); err != nil {
+			return fmt.Errorf("root %s: %v", r.Spec, err)
+		}
+	}
+	return nil
+}
+
+// Export every root, only rendering pages edited since the previous export
+// when incremental is set
+func runExport(s *settings, incremental bool) {
+	requireToken(s)
+	requireRoots(s)
+	if code := export(s, incremental); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// Export every root and report the result, returning the exit code
+func export(s *settings, incremental bool) int {
+	conf.Incremental = incremental
+	if s.Strict && s.Threshold < 0 {
+		s.Threshold = 0
+	}
+	recorder := recordChanges(s)
+	stopProgress := startProgress(s.Progress)
+
+	if err := discoverRoots(s); err != nil {
+		stopProgress()
+		slog.Error("failed to discover pages, nothing was exported", "error", err)
+		return exitFailed
+	}
+	previous := exportTree(s.Token, s.Roots)
+	reportSlugCollisions()
+
+	for _, r := range s.Roots {
+		if r.Sidebars == "" {
+			continue
+		}
+		r.use()
+		if err := writeSidebars(r.node, r.Sidebars); err != nil {
+			slog.Error("failed to write sidebars file", "path", r.Sidebars, "error", err)
+		}
+	}
+
+	if s.PruneAssets {
+		pruneAssetDirs(s.Roots, previous)
+	}
+	stopProgress()
+
+	// Keep stdout for the JSON summary when it is written there
+	var out io.Writer = os.Stdout
+	if s.SummaryJSON == "-" {
+		out = os.Stderr
+	}
+
+	if recorder != nil {
+		recorder.finish()
+		recorder.report(out, s.Diff)
+	}
+	if !s.DryRun {
+		saveBookmarkCache()
+	}
+
+	printSummary(out)
+	if s.SummaryJSON != "" {
+		if err := writeSummaryJSON(s.SummaryJSON); err != nil {
+			slog.Error("failed to write summary", "path", s.SummaryJSON, "error", err)
+		}
+	}
+	if s.Strict {
+		printProblems(out)
+	}
+	if code := exitCode(s.Threshold); code != 0 {
+		slog.Error("export finished with problems", "pages_failed", stats.PagesFailed, "warnings", warningCount(), "strict_threshold", s.Threshold)
+		return code
+	}
+	if s.DryRun {
+		fmt.Fprintln(out, "Dry run, nothing was written.")
+	} else {
+		fmt.Fprintln(out, "Export completed successfully.")
+	}
+	return 0
+}
+
+// Record the changes made by a command when -dry-run or -diff is set
+func recordChanges(s *settings) *recordingWriter {
+	if !s.DryRun && !s.Diff {
+		return nil
+	}
+	recorder := newRecordingWriter(s.DryRun)
+	output = recorder
+	return recorder
+}
+
+// Prune the assets directory of every root once, removing the assets listed
+// in the manifests of the roots sharing it. manifests are those of roots, in
+// the same order.
+func pruneAssetDirs(roots []*exportRoot, manifests []*manifest) {
+	var dirs []string
+	listed := make(map[string][]string)
+	for i, r := range roots {
+		dir := filepath.Clean(r.AssetsDir)
+		if _, ok := listed[dir]; !ok {
+			dirs = append(dirs, r.AssetsDir)
+			listed[dir] = nil
+		}
+		for _, entry := range manifests[i].Pages {
+			listed[dir] = append(listed[dir], entry.Assets...)
+		}
+	}
+	for _, dir := range dirs {
+		pruneAssets(dir, listed[filepath.Clean(dir)])
+	}
+}
+
+// Check that every root can be reached and that all blocks of the pages
+// below them can be rendered. Nothing is written.
+func runValidate(s *settings) {
+	requireToken(s)
+	requireRoots(s)
+	if err := discoverRoots(s); err != nil {
+		fatal("failed to discover pages", "error", err)
+	}
+
+	ids := make([]string, 0, len(discovered))
+	for id, node := range discovered {
+		if node.Page != nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	problems := 0
+	var check func(node *docNode, blockID string)
+	check = func(node *docNode, blockID string) {
+		blocks, err := fetchAllChildren(s.Token, blockID)
+		if err != nil {
+			fmt.Printf("%s (%s): failed to fetch blocks of %s: %v\n", node.Title, node.ID, blockID, err)
+			problems++
+			return
+		}
+		for _, block := range blocks {
+			if !renderedBlocks[block.Type] {
+				fmt.Printf("%s (%s): unsupported block %s (%s)\n", node.Title, node.ID, block.Type, block.ID)
+				problems++
+			}
+			if block.HasChildren && block.Type != "child_page" {
+				check(node, block.ID)
+			}
+		}
+	}
+	for _, id := range ids {
+		check(discovered[id], id)
+	}
+
+	fmt.Printf("Checked %d page(s) in %d root(s), %d problem(s) found.\n", len(ids), len(s.Roots), problems)
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
+
+// Remove the files listed in the manifests of the roots, the category files
+// and directories left behind, the generated sidebars files and, unless
+// -prune-assets=false, the downloaded assets
+func runClean(s *settings) {
+	requireRoots(s)
+	recorder := recordChanges(s)
+
+	manifests := make([]*manifest, len(s.Roots))
+	for i, r := range s.Roots {
+		m := loadManifest(r.OutputDir)
+		manifests[i] = m
+		dirs := make(map[string]bool)
+		for _, entry := range m.Pages {
+			err := output.Remove(filepath.Join(r.OutputDir, filepath.FromSlash(entry.Path)))
+			if err != nil && !os.IsNotExist(err) {
+				slog.Error("failed to remove page", "path", entry.Path, "error", err)
+				continue
+			}
+			dirs[path.Dir(entry.Path)] = true
+		}
+		if err := output.Remove(filepath.Join(r.OutputDir, manifestFile)); err != nil && !os.IsNotExist(err) {
+			slog.Error("failed to remove manifest", "output", r.OutputDir, "error", err)
+		}
+
+		// Deepest directories first so parents become empty in turn
+		sorted := make([]string, 0, len(dirs))
+		for dir := range dirs {
+			sorted = append(sorted, dir)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+		for _, dir := range sorted {
+			removeGeneratedDirs(r.OutputDir, dir)
+		}
+		fmt.Printf("Removed %d page(s) from %s\n", len(m.Pages), r.OutputDir)
+
+		if r.Sidebars != "" {
+			if data, err := os.ReadFile(r.Sidebars); err == nil && strings.HasPrefix(string(data), sidebarsHeader) {
+				output.Remove(r.Sidebars)
+			}
+		}
+	}
+
+	if s.PruneAssets {
+		pruneAssetDirs(s.Roots, manifests)
+	}
+
+	if recorder != nil {
+		recorder.finish()
+		recorder.report(os.Stdout, s.Diff)
+	}
+}
+
+// Remove dir and its parents, up to but excluding outputDir, while they
+// contain nothing but a _category_.json file
+func removeGeneratedDirs(outputDir string, dir string) {
+	for dir != "." && dir != "/" && dir != "" {
+		full := filepath.Join(outputDir, filepath.FromSlash(dir))
+		entries, err := os.ReadDir(full)
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			if e.Name() != "_category_.json" {
+				return
+			}
+		}
+		output.Remove(filepath.Join(full, "_category_.json"))
+		if err := output.Remove(full); err != nil {
+			return
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// GET an API endpoint for inspect, returning the response body unchanged.
+// Responses aren't cached.
+func fetchRaw(token string, url string) ([]byte, error) {
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("Notion-Version", "2022-06-28")
+
+	stats.APICalls++
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == 429 {
+		stats.APIRetries++
+		slog.Warn("rate limited, retrying", "url", url, "wait", 3*time.Second)
+		time.Sleep(3 * time.Second)
+		return fetchRaw(token, url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s: %s", url, resp.Status, body)
+	}
+	return body, nil
+}
+
+// Children of a block as returned by the API, with their own children added
+// under a "children" key
+func inspectBlocks(token string, blockID string) ([]json.RawMessage, error) {
+	var blocks []json.RawMessage
+	cursor := ""
+	for {
+		url := fmt.Sprintf("https://api.notion.com/v1/blocks/%s/children?page_size=100", blockID)
+		if cursor != "" {
+			url += "&start_cursor=" + cursor
+		}
+		body, err := fetchRaw(token, url)
+		if err != nil {
+			return nil, err
+		}
+		var response struct {
+			Results    []json.RawMessage `json:"results"`
+			NextCursor string            `json:"next_cursor"`
+			HasMore    bool              `json:"has_more"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, err
+		}
+
+		for _, raw := range response.Results {
+			var block struct {
+				ID          string `json:"id"`
+				Type        string `json:"type"`
+				HasChildren bool   `json:"has_children"`
+			}
+			if err := json.Unmarshal(raw, &block); err != nil {
+				return nil, err
+			}
+			if block.HasChildren && block.Type != "child_page" {
+				children, err := inspectBlocks(token, block.ID)
+				if err != nil {
+					return nil, err
+				}
+				encoded, err := json.Marshal(children)
+				if err != nil {
+					return nil, err
+				}
+				// Added before the closing brace, so the fields of the API
+				// keep their order
+				var b bytes.Buffer
+				b.Write(bytes.TrimSuffix(bytes.TrimSpace(raw), []byte("}")))
+				b.WriteString(`,"children":`)
+				b.Write(encoded)
+				b.WriteByte('}')
+				raw = b.Bytes()
+			}
+			blocks = append(blocks, raw)
+		}
+
+		if !response.HasMore {
+			return blocks, nil
+		}
+		cursor = response.NextCursor
+	}
+}
+
+// Print a page with its block tree as JSON, as returned by the API
+func runInspect(s *settings) {
+	requireToken(s)
+	if len(s.Args) != 1 {
+		fatal("usage: nosaurus-go inspect [flags]" + commandArgs["inspect"])
+	}
+	id, err := parseNotionID(s.Args[0])
+	if err != nil {
+		fatal("invalid ID", "error", err)
+	}
+
+	out := struct {
+		Page   json.RawMessage   `json:"page,omitempty"`
+		Blocks []json.RawMessage `json:"blocks"`
+	}{}
+	if body, err := fetchRaw(s.Token, "https://api.notion.com/v1/pages/"+id); err == nil {
+		var page struct {
+			Object string `json:"object"`
+		}
+		if json.Unmarshal(body, &page) == nil && page.Object == objectPage {
+			out.Page = body
+		}
+	}
+	if out.Blocks, err = inspectBlocks(s.Token, id); err != nil {
+		fatal("failed to fetch blocks", "block_id", id, "error", err)
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		fatal("failed to encode blocks", "error", err)
+	}
+	fmt.Println(string(data))
+}
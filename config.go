@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config files looked up in the working directory when -config isn't given
+var defaultConfigFiles = []string{"nosaurus.yaml", "nosaurus.yml", "nosaurus.toml"}
+
+// Config file keys and environment variables for flags whose names are too
+// short to be readable. Every other flag uses its own name.
+var configAliases = map[string]string{
+	"t":    "token",
+	"r":    "id",
+	"o":    "output",
+	"root": "roots",
+	"v":    "verbose",
+	"q":    "quiet",
+}
+
+// Key of a flag in the config file
+func configKey(flagName string) string {
+	if alias, ok := configAliases[flagName]; ok {
+		return alias
+	}
+	return flagName
+}
+
+// Environment variable overriding a flag, e.g. NOSAURUS_DB_FILTER. The token
+// can also be given as NOTION_TOKEN.
+func envNames(flagName string) []string {
+	name := "NOSAURUS_" + strings.ToUpper(strings.ReplaceAll(configKey(flagName), "-", "_"))
+	if flagName == "t" {
+		return []string{"NOTION_TOKEN", name}
+	}
+	return []string{name}
+}
+
+// Read a YAML or TOML config file into its top level settings
+func loadConfigFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]interface{})
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(data, &settings)
+	} else {
+		err = yaml.Unmarshal(data, &settings)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return settings, nil
+}
+
+// Flag values of a config setting. Lists give one value per item for
+// repeatable flags and comma separated items otherwise, maps are written as
+// comma separated key=value pairs, e.g. the props mapping or a root.
+func configFlagValues(value interface{}, repeatable bool) ([]string, error) {
+	switch v := value.(type) {
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i := range v {
+			items[i] = v[i]
+		}
+		return configFlagValues(items, repeatable)
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			values, err := configFlagValues(item, false)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, values...)
+		}
+		if repeatable {
+			return items, nil
+		}
+		return []string{strings.Join(items, ",")}, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var pairs []string
+		for _, key := range keys {
+			if _, nested := v[key].(map[string]interface{}); nested {
+				return nil, fmt.Errorf("%s: nested settings are not supported", key)
+			}
+			values, err := configFlagValues(v[key], false)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, key+"="+strings.Join(values, ","))
+		}
+		return []string{strings.Join(pairs, ",")}, nil
+	case nil:
+		return nil, nil
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
+
+// Fill in the flags that weren't given on the command line, from environment
+// variables first and then from the config file. An empty path looks for one
+// of the default config files, which don't have to exist.
+func applyConfig(fs *flag.FlagSet, path string) error {
+	if path == "" {
+		for _, name := range defaultConfigFiles {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+	}
+
+	settings := make(map[string]interface{})
+	if path != "" {
+		var err error
+		if settings, err = loadConfigFile(path); err != nil {
+			return err
+		}
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	known := make(map[string]bool)
+	var errs []string
+	fs.VisitAll(func(f *flag.Flag) {
+		key := configKey(f.Name)
+		known[key] = true
+		if set[f.Name] || f.Name == "config" {
+			return
+		}
+
+		for _, env := range envNames(f.Name) {
+			if value, ok := os.LookupEnv(env); ok {
+				if err := fs.Set(f.Name, value); err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %v", env, err))
+				}
+				return
+			}
+		}
+
+		value, ok := settings[key]
+		if !ok {
+			return
+		}
+		_, repeatable := f.Value.(*rootFlags)
+		values, err := configFlagValues(value, repeatable)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+			return
+		}
+		for _, v := range values {
+			if err := fs.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+			}
+		}
+	})
+
+	for key := range settings {
+		if !known[key] {
+			errs = append(errs, fmt.Sprintf("unknown setting %q", key))
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		if path == "" {
+			path = "environment"
+		}
+		return fmt.Errorf("%s: %s", path, strings.Join(errs, "; "))
+	}
+	return nil
+}
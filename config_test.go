@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigFlagValues(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      interface{}
+		repeatable bool
+		want       []string
+		wantErr    bool
+	}{
+		{name: "string", value: "./docs", want: []string{"./docs"}},
+		{name: "bool", value: true, want: []string{"true"}},
+		{name: "number", value: 3, want: []string{"3"}},
+		{name: "nil", value: nil, want: nil},
+		{name: "list", value: []interface{}{"Order", "created_time"}, want: []string{"Order,created_time"}},
+		{name: "repeatable list", value: []interface{}{"a", "b"}, repeatable: true, want: []string{"a", "b"}},
+		{name: "map", value: map[string]interface{}{"Slug": "slug", "Name": "title"}, want: []string{"Name=title,Slug=slug"}},
+		{
+			name: "repeatable list of maps",
+			value: []map[string]interface{}{
+				{"id": "a", "out": "./a"},
+				{"id": "b", "out": "./b", "docs": "/b"},
+			},
+			repeatable: true,
+			want:       []string{"id=a,out=./a", "docs=/b,id=b,out=./b"},
+		},
+		{name: "map with list", value: map[string]interface{}{"Tags": []interface{}{"x", "y"}}, want: []string{"Tags=x,y"}},
+		{name: "nested map", value: map[string]interface{}{"a": map[string]interface{}{"b": 1}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := configFlagValues(tt.value, tt.repeatable)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	yamlConfig := `
+token: file-token
+output: ./from-file
+docs: /file
+verbose: true
+roots:
+  - id: a
+    out: ./a
+  - id: b
+    out: ./b
+`
+	tomlConfig := `
+token = "file-token"
+output = "./from-file"
+docs = "/file"
+verbose = true
+
+[[roots]]
+id = "a"
+out = "./a"
+
+[[roots]]
+id = "b"
+out = "./b"
+`
+
+	tests := []struct {
+		name    string
+		file    string
+		config  string
+		args    []string
+		env     map[string]string
+		want    map[string]string
+		roots   []string
+		wantErr string
+	}{
+		{
+			name:   "file",
+			file:   "nosaurus.yaml",
+			config: yamlConfig,
+			want:   map[string]string{"t": "file-token", "o": "./from-file", "docs": "/file", "v": "true"},
+			roots:  []string{"id=a,out=./a", "id=b,out=./b"},
+		},
+		{
+			name:   "toml file",
+			file:   "nosaurus.toml",
+			config: tomlConfig,
+			want:   map[string]string{"t": "file-token", "o": "./from-file", "docs": "/file", "v": "true"},
+			roots:  []string{"id=a,out=./a", "id=b,out=./b"},
+		},
+		{
+			name:   "environment over file",
+			file:   "nosaurus.yaml",
+			config: yamlConfig,
+			env:    map[string]string{"NOTION_TOKEN": "env-token", "NOSAURUS_OUTPUT": "./from-env"},
+			want:   map[string]string{"t": "env-token", "o": "./from-env", "docs": "/file"},
+			roots:  []string{"id=a,out=./a", "id=b,out=./b"},
+		},
+		{
+			name:   "flags over environment",
+			file:   "nosaurus.yaml",
+			config: yamlConfig,
+			args:   []string{"-t", "flag-token", "-root", "id=c,out=./c"},
+			env:    map[string]string{"NOTION_TOKEN": "env-token", "NOSAURUS_DOCS": "/env"},
+			want:   map[string]string{"t": "flag-token", "o": "./from-file", "docs": "/env"},
+			roots:  []string{"id=c,out=./c"},
+		},
+		{
+			name:    "unknown setting",
+			file:    "nosaurus.yaml",
+			config:  "token: x\ncolour: blue\n",
+			wantErr: `unknown setting "colour"`,
+		},
+		{
+			name:    "invalid environment value",
+			env:     map[string]string{"NOSAURUS_VERBOSE": "loud"},
+			wantErr: "NOSAURUS_VERBOSE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"NOTION_TOKEN", "NOSAURUS_TOKEN", "NOSAURUS_OUTPUT", "NOSAURUS_DOCS", "NOSAURUS_VERBOSE", "NOSAURUS_ROOTS"} {
+				t.Setenv(name, "")
+				os.Unsetenv(name)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), tt.file)
+				if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			fs.String("config", "", "")
+			fs.String("t", "", "")
+			fs.String("o", "", "")
+			fs.String("docs", "", "")
+			fs.Bool("v", false, "")
+			var roots rootFlags
+			fs.Var(&roots, "root", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applyConfig(fs, path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("-%s = %q, want %q", name, got, want)
+				}
+			}
+			if !reflect.DeepEqual([]string(roots), tt.roots) {
+				t.Errorf("roots = %q, want %q", roots, tt.roots)
+			}
+		})
+	}
+}
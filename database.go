@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Body of a database query request
+type databaseQuery struct {
+	StartCursor string          `json:"start_cursor,omitempty"`
+	PageSize    int             `json:"page_size,omitempty"`
+	Sorts       []databaseSort  `json:"sorts,omitempty"`
+	Filter      json.RawMessage `json:"filter,omitempty"`
+}
+
+// Sort criterion of a database query, on a property or on a page timestamp
+type databaseSort struct {
+	Property  string `json:"property,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Direction string `json:"direction"`
+}
+
+// Parse database sorts given as comma separated Property[:asc|desc] items.
+// created_time and last_edited_time sort on the page timestamps.
+func parseDatabaseSorts(spec string) ([]databaseSort, error) {
+	var sorts []databaseSort
+	for _, item := range strings.Split(spec, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		name, dir, _ := strings.Cut(item, ":")
+		name = strings.TrimSpace(name)
+
+		s := databaseSort{Direction: "ascending"}
+		switch strings.ToLower(strings.TrimSpace(dir)) {
+		case "", "asc", "ascending":
+		case "desc", "descending":
+			s.Direction = "descending"
+		default:
+			return nil, fmt.Errorf("unknown sort direction %q for %s", dir, name)
+		}
+
+		if name == "created_time" || name == "last_edited_time" {
+			s.Timestamp = name
+		} else {
+			s.Property = name
+		}
+		sorts = append(sorts, s)
+	}
+	return sorts, nil
+}
+
+// Position of a page in the sidebar: the value of the property mapped to the
+// position role when the page has one, fallback otherwise
+func pagePosition(page NotionPage, fallback float64) float64 {
+	if prop, ok := findProperty(page, rolePosition); ok {
+		if value, ok := prop.Float(); ok {
+			return value
+		}
+	}
+	return fallback
+}
+
+// Represents a database or data source, only the property schema is used
+type NotionDatabase struct {
+	Object     string                    `json:"object"`
+	ID         string                    `json:"id"`
+	Properties map[string]DatabaseColumn `json:"properties"`
+}
+
+// Represents a property of a database schema
+type DatabaseColumn struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Fetch the schema of a database or data source
+func fetchDatabase(token string, kind string, databaseID string) (*NotionDatabase, error) {
+	url, version := collectionEndpoint(kind, databaseID)
+	cacheKey := url
+
+	if cachedResponse, found := apiCache.Get(cacheKey); found {
+		return cachedResponse.(*NotionDatabase), nil
+	}
+
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("Notion-Version", version)
+
+	stats.APICalls++
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == 429 {
+		stats.APIRetries++
+		emitRateLimited(3 * time.Second)
+		slog.Warn("rate limited, retrying", "url", url, "wait", 3*time.Second)
+		time.Sleep(3 * time.Second)
+		return fetchDatabase(token, kind, databaseID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s %s: %s: %s", kind, databaseID, resp.Status, body)
+	}
+
+	var response NotionDatabase
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	apiCache.Set(cacheKey, &response, 600*time.Second)
+
+	return &response, nil
+}
+
+// A condition of the database filter, Property=Value or Property!=Value
+type filterCondition struct {
+	Property string
+	Value    string
+	Negate   bool
+}
+
+// Parse a filter expression of comma separated conditions that all have to
+// match, e.g. "Status=Published,Public=true"
+func parseDatabaseFilter(spec string) ([]filterCondition, error) {
+	var conditions []filterCondition
+	for _, item := range strings.Split(spec, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		c := filterCondition{}
+		name, value, ok := strings.Cut(item, "!=")
+		if ok {
+			c.Negate = true
+		} else if name, value, ok = strings.Cut(item, "="); !ok {
+			return nil, fmt.Errorf("condition %q is not Property=Value or Property!=Value", item)
+		}
+		c.Property = strings.TrimSpace(name)
+		c.Value = strings.TrimSpace(value)
+		if c.Property == "" {
+			return nil, fmt.Errorf("condition %q has no property", item)
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, nil
+}
+
+// Translate filter conditions into a Notion query filter, using the schema
+// of the database for the property types
+func buildDatabaseFilter(db *NotionDatabase, conditions []filterCondition) (json.RawMessage, error) {
+	var filters []map[string]interface{}
+	for _, c := range conditions {
+		column, ok := db.Properties[c.Property]
+		if !ok {
+			return nil, fmt.Errorf("database %s has no property %q", db.ID, c.Property)
+		}
+
+		op := "equals"
+		if c.Negate {
+			op = "does_not_equal"
+		}
+		var value interface{} = c.Value
+
+		switch column.Type {
+		case "title", "rich_text", "url", "email", "phone_number", "select", "status":
+		case "number":
+			n, err := strconv.ParseFloat(c.Value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("filter on %s: %q is not a number", c.Property, c.Value)
+			}
+			value = n
+		case "checkbox":
+			b, err := strconv.ParseBool(c.Value)
+			if err != nil {
+				return nil, fmt.Errorf("filter on %s: %q is not a boolean", c.Property, c.Value)
+			}
+			value = b
+		case "multi_select":
+			op = "contains"
+			if c.Negate {
+				op = "does_not_contain"
+			}
+		case "people", "relation":
+			// Notion only matches these by user or page ID
+			id, err := parseNotionID(c.Value)
+			if err != nil {
+				return nil, fmt.Errorf("filter on %s: %s properties are matched by ID: %v", c.Property, column.Type, err)
+			}
+			value = id
+			op = "contains"
+			if c.Negate {
+				op = "does_not_contain"
+			}
+		case "date":
+			if c.Negate {
+				return nil, fmt.Errorf("filter on %s: dates can only be compared with =", c.Property)
+			}
+		default:
+			return nil, fmt.Errorf("filter on %s: %s properties are not supported", c.Property, column.Type)
+		}
+
+		filters = append(filters, map[string]interface{}{
+			"property":  c.Property,
+			column.Type: map[string]interface{}{op: value},
+		})
+	}
+
+	switch len(filters) {
+	case 0:
+		return nil, nil
+	case 1:
+		return json.Marshal(filters[0])
+	default:
+		return json.Marshal(map[string]interface{}{"and": filters})
+	}
+}
+
+// Whether a page passes the database filter. Used for pages reached through
+// links and Sub-Items rather than a query, conditions on properties the page
+// doesn't have are ignored.
+func matchesFilter(page NotionPage) bool {
+	for _, c := range conf.DatabaseFilter {
+		prop, ok := page.Properties[c.Property]
+		if !ok {
+			continue
+		}
+
+		var match bool
+		switch prop.Type {
+		case "checkbox":
+			want, err := strconv.ParseBool(c.Value)
+			got, _ := prop.Bool()
+			match = err == nil && got == want
+		case "number":
+			want, err := strconv.ParseFloat(c.Value, 64)
+			got, ok := prop.Float()
+			match = err == nil && ok && got == want
+		case "multi_select":
+			match = containsString(prop.List(), c.Value)
+		case "people":
+			id, _ := parseNotionID(c.Value)
+			for _, user := range prop.People {
+				match = match || user.ID == id
+			}
+		case "relation":
+			id, _ := parseNotionID(c.Value)
+			match = containsString(prop.RelationIDs(), id)
+		default:
+			match = prop.Text() == c.Value
+		}
+
+		if match == c.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
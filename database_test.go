@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDatabaseFilter(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []filterCondition
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "Status=Published", want: []filterCondition{{Property: "Status", Value: "Published"}}},
+		{in: " Status = Published , Public!=false ,", want: []filterCondition{
+			{Property: "Status", Value: "Published"},
+			{Property: "Public", Value: "false", Negate: true},
+		}},
+		{in: "Formula=a=b", want: []filterCondition{{Property: "Formula", Value: "a=b"}}},
+		{in: "Tag=", want: []filterCondition{{Property: "Tag", Value: ""}}},
+		{in: "Status", wantErr: true},
+		{in: "=Published", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDatabaseFilter(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseDatabaseFilter(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDatabaseFilter(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestBuildDatabaseFilter(t *testing.T) {
+	db := &NotionDatabase{ID: "db", Properties: map[string]DatabaseColumn{
+		"Name":   {Type: "title"},
+		"Status": {Type: "status"},
+		"Order":  {Type: "number"},
+		"Public": {Type: "checkbox"},
+		"Tags":   {Type: "multi_select"},
+		"Owner":  {Type: "people"},
+		"Parent": {Type: "relation"},
+		"Date":   {Type: "date"},
+		"Files":  {Type: "files"},
+	}}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: "Status=Published", want: `{"property":"Status","status":{"equals":"Published"}}`},
+		{in: "Name!=Draft", want: `{"property":"Name","title":{"does_not_equal":"Draft"}}`},
+		{in: "Order=2.5", want: `{"number":{"equals":2.5},"property":"Order"}`},
+		{in: "Public=true", want: `{"checkbox":{"equals":true},"property":"Public"}`},
+		{in: "Tags!=internal", want: `{"multi_select":{"does_not_contain":"internal"},"property":"Tags"}`},
+		{in: "Owner=0123456789ABCDEF0123456789ABCDEF", want: `{"people":{"contains":"01234567-89ab-cdef-0123-456789abcdef"},"property":"Owner"}`},
+		{in: "Parent!=https://www.notion.so/Page-0123456789abcdef0123456789abcdef", want: `{"property":"Parent","relation":{"does_not_contain":"01234567-89ab-cdef-0123-456789abcdef"}}`},
+		{in: "Date=2024-01-02", want: `{"date":{"equals":"2024-01-02"},"property":"Date"}`},
+		{
+			in:   "Status=Published,Public=true",
+			want: `{"and":[{"property":"Status","status":{"equals":"Published"}},{"checkbox":{"equals":true},"property":"Public"}]}`,
+		},
+		{in: "Missing=x", wantErr: true},
+		{in: "Order=two", wantErr: true},
+		{in: "Public=maybe", wantErr: true},
+		{in: "Owner=Jane Doe", wantErr: true},
+		{in: "Date!=2024-01-02", wantErr: true},
+		{in: "Files=a.png", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		conditions, err := parseDatabaseFilter(tt.in)
+		if err != nil {
+			t.Fatalf("parseDatabaseFilter(%q): %v", tt.in, err)
+		}
+		got, err := buildDatabaseFilter(db, conditions)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("buildDatabaseFilter(%q) = %s, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || string(got) != tt.want {
+			t.Errorf("buildDatabaseFilter(%q) = %s, %v, want %s", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestMatchesFilter(t *testing.T) {
+	page := NotionPage{Properties: map[string]Property{
+		"Status": {Type: "status", Status: &SelectOption{Name: "Published"}},
+		"Public": {Type: "checkbox", Checkbox: true},
+		"Owner":  {Type: "people", People: []User{{ID: "01234567-89ab-cdef-0123-456789abcdef", Name: "Jane Doe"}}},
+	}}
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{"", true},
+		{"Status=Published", true},
+		{"Status=Draft", false},
+		{"Status!=Draft", true},
+		{"Public=true", true},
+		{"Public=false", false},
+		{"Owner=0123456789abcdef0123456789abcdef", true},
+		{"Owner=Jane Doe", false},
+		{"Owner!=fedcba9876543210fedcba9876543210", true},
+		{"Missing=x", true},
+		{"Status=Published,Public=false", false},
+	}
+
+	defer func(saved []filterCondition) { conf.DatabaseFilter = saved }(conf.DatabaseFilter)
+	for _, tt := range tests {
+		conf.DatabaseFilter, _ = parseDatabaseFilter(tt.filter)
+		if got := matchesFilter(page); got != tt.want {
+			t.Errorf("matchesFilter with %q = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
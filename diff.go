@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Lines of unchanged context around the changes of a diff hunk
+const diffContext = 3
+
+// Largest table of changed lines diffed, about 16 MB. Bigger changes are
+// only reported as changed.
+const maxDiffCells = 1 << 22
+
+// Files with NUL bytes or invalid UTF-8 aren't diffed
+func isBinary(data []byte) bool {
+	return strings.IndexByte(string(data), 0) >= 0 || !utf8.Valid(data)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// An edit of a line diff: ' ' keeps a line, '-' removes one from the old
+// text and '+' adds one from the new text
+type diffOp struct {
+	Kind byte
+	Line string
+}
+
+// Line edits turning a into b, from their longest common subsequence. False
+// when the changed lines are too many to compare.
+func diffLines(a, b []string) ([]diffOp, bool) {
+	// Common prefix and suffix don't need the quadratic table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(ma), len(mb)
+	if (n+1)*(m+1) > maxDiffCells {
+		return nil, false
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && ma[i] == mb[j]:
+			ops = append(ops, diffOp{' ', ma[i]})
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', ma[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', mb[j]})
+			j++
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops, true
+}
+
+// Unified diff between two texts, empty when they are equal. False when they
+// are too different to diff.
+func unifiedDiff(oldName, newName, a, b string) (string, bool) {
+	ops, ok := diffLines(splitLines(a), splitLines(b))
+	if !ok {
+		return "", false
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	changed := false
+
+	for start := 0; start < len(ops); {
+		// Find the next change and the end of its hunk, merging changes
+		// whose context overlaps
+		first := start
+		for first < len(ops) && ops[first].Kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		changed = true
+		last := first
+		for k := first; k < len(ops); k++ {
+			if ops[k].Kind != ' ' {
+				last = k
+			} else if k-last > 2*diffContext {
+				break
+			}
+		}
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		to := last + diffContext + 1
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		// Line numbers of the hunk in both texts
+		oldLine, newLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.Kind != '+' {
+				oldLine++
+			}
+			if op.Kind != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.Kind != '+' {
+				oldCount++
+			}
+			if op.Kind != '-' {
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			oldLine--
+		}
+		if newCount == 0 {
+			newLine--
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+		for _, op := range ops[from:to] {
+			out.WriteByte(op.Kind)
+			out.WriteString(op.Line)
+			if !strings.HasSuffix(op.Line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+
+	if !changed {
+		return "", true
+	}
+	return out.String(), true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	numbered := func(n int, replace map[int]string) string {
+		var sb strings.Builder
+		for i := 1; i <= n; i++ {
+			if line, ok := replace[i]; ok {
+				sb.WriteString(line + "\n")
+			} else {
+				fmt.Fprintf(&sb, "%d\n", i)
+			}
+		}
+		return sb.String()
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name: "changed line",
+			a:    "a\nb\nc\n",
+			b:    "a\nB\nc\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "created",
+			a:    "",
+			b:    "x\ny\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			name: "deleted",
+			a:    "x\ny\n",
+			b:    "",
+			want: "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-x\n-y\n",
+		},
+		{
+			name: "missing newline",
+			a:    "a\n",
+			b:    "a",
+			want: "--- old\n+++ new\n@@ -1,1 +1,1 @@\n-a\n+a\n\\ No newline at end of file\n",
+		},
+		{
+			name: "separate hunks",
+			a:    numbered(20, nil),
+			b:    numbered(20, map[int]string{2: "two", 19: "nineteen"}),
+			want: "--- old\n+++ new\n" +
+				"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n" +
+				"@@ -16,5 +16,5 @@\n 16\n 17\n 18\n-19\n+nineteen\n 20\n",
+		},
+		{
+			name: "merged hunks",
+			a:    numbered(10, nil),
+			b:    numbered(10, map[int]string{3: "three", 8: "eight"}),
+			want: "--- old\n+++ new\n" +
+				"@@ -1,10 +1,10 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n 7\n-8\n+eight\n 9\n 10\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := unifiedDiff("old", "new", tt.a, tt.b)
+			if !ok {
+				t.Fatal("diff reported as too large")
+			}
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffTooLarge(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&a, "old %d\n", i)
+		fmt.Fprintf(&b, "new %d\n", i)
+	}
+	if _, ok := unifiedDiff("old", "new", a.String(), b.String()); ok {
+		t.Error("expected the diff to be too large")
+	}
+
+	// Unchanged lines around the change don't count
+	same := strings.Repeat("same\n", 10000)
+	if _, ok := unifiedDiff("old", "new", same+"a\n"+same, same+"b\n"+same); !ok {
+		t.Error("expected a small change in a large file to be diffed")
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Docusaurus frontmatter of a page, fields are written in declaration order
+// followed by the fields mapped from custom property roles
+type frontmatter struct {
+	Title               string                 `yaml:"title"`
+	Slug                string                 `yaml:"slug,omitempty"`
+	NotionID            string                 `yaml:"notion_id,omitempty"`
+	Description         string                 `yaml:"description,omitempty"`
+	Tags                []string               `yaml:"tags,omitempty"`
+	Keywords            []string               `yaml:"keywords,omitempty"`
+	Image               string                 `yaml:"image,omitempty"`
+	SidebarPosition     float64                `yaml:"sidebar_position"`
+	HideTableOfContents bool                   `yaml:"hide_table_of_contents,omitempty"`
+	Draft               bool                   `yaml:"draft,omitempty"`
+	LastUpdate          *lastUpdate            `yaml:"last_update,omitempty"`
+	CustomEditURL       string                 `yaml:"custom_edit_url,omitempty"`
+	Extra               map[string]interface{} `yaml:",inline"`
+}
+
+// Fields set by the exporter itself that properties can't be mapped to
+var generatedFields = map[string]bool{
+	"notion_id":        true,
+	"sidebar_position": true,
+}
+
+type lastUpdate struct {
+	Date   string `yaml:"date,omitempty"`
+	Author string `yaml:"author,omitempty"`
+}
+
+// Build the frontmatter of a page from its mapped properties
+func buildFrontmatter(page NotionPage, title string, slug string, position float64) frontmatter {
+	fm := frontmatter{
+		Title:           title,
+		Slug:            slug,
+		NotionID:        page.ID,
+		SidebarPosition: position,
+	}
+
+	if prop, ok := findProperty(page, roleDescription); ok {
+		fm.Description = prop.Text()
+	}
+	if prop, ok := findProperty(page, roleKeywords); ok {
+		fm.Keywords = prop.List()
+	}
+	if prop, ok := findProperty(page, roleTags); ok {
+		fm.Tags = prop.List()
+	} else {
+		// Before tags had their own role the keywords were used as tags
+		fm.Tags = fm.Keywords
+	}
+	if prop, ok := findProperty(page, roleImage); ok {
+		fm.Image = frontmatterImage(prop)
+	}
+	if prop, ok := findProperty(page, roleHideTOC); ok {
+		fm.HideTableOfContents, _ = prop.Bool()
+	}
+	if prop, ok := findProperty(page, roleDraft); ok {
+		fm.Draft, _ = prop.Bool()
+	}
+	if prop, ok := findProperty(page, roleLastUpdate); ok {
+		fm.LastUpdate = frontmatterLastUpdate(prop)
+	}
+	if prop, ok := findProperty(page, roleEditURL); ok {
+		fm.CustomEditURL = prop.Text()
+	} else if conf.NotionEditURL {
+		fm.CustomEditURL = page.URL
+	}
+
+	// Properties mapped to any other role become fields of that name
+	for name, role := range conf.PropertyMap {
+		if builtinRoles[role] || generatedFields[role] {
+			continue
+		}
+		prop, ok := page.Properties[name]
+		if !ok {
+			continue
+		}
+		if value := frontmatterValue(prop); value != nil {
+			if fm.Extra == nil {
+				fm.Extra = make(map[string]interface{})
+			}
+			fm.Extra[role] = value
+		}
+	}
+
+	return fm
+}
+
+// Encode frontmatter as YAML, without the surrounding --- lines
+func renderFrontmatter(fm frontmatter) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(fm); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Value of a property in its natural YAML type, nil when empty
+func frontmatterValue(prop Property) interface{} {
+	switch prop.Type {
+	case "multi_select", "people", "relation", "files":
+		if list := prop.List(); len(list) > 0 {
+			return list
+		}
+		return nil
+	case "checkbox":
+		value, _ := prop.Bool()
+		return value
+	case "number", "unique_id":
+		if n, ok := prop.Float(); ok {
+			if n == float64(int64(n)) {
+				return int64(n)
+			}
+			return n
+		}
+		return nil
+	}
+	if text := prop.Text(); text != "" {
+		return text
+	}
+	return nil
+}
+
+// Social card image from a files or url property. Notion-hosted files are
+// downloaded since their URLs expire.
+func frontmatterImage(prop Property) string {
+	if prop.Type != "files" {
+		return prop.Text()
+	}
+	for _, file := range prop.Files {
+		switch {
+		case file.File != nil:
+			img, err := downloadImage(file.File.URL)
+			if err != nil {
+				reportProblem(problemAssetFailed, "failed to download frontmatter image", "url", file.File.URL, "error", err)
+				stats.AssetsFailed++
+				continue
+			}
+			return img.URL()
+		case file.External != nil:
+			return file.External.URL
+		}
+	}
+	return ""
+}
+
+// last_update from a date or time property, or from a people property naming
+// the author
+func frontmatterLastUpdate(prop Property) *lastUpdate {
+	if t, ok := prop.Time(); ok {
+		return &lastUpdate{Date: t.Format("2006-01-02")}
+	}
+	if author := prop.Text(); author != "" {
+		return &lastUpdate{Author: author}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRenderFrontmatter(t *testing.T) {
+	const properties = `{
+	  "Description": {"type": "rich_text", "rich_text": [{"plain_text": "Install it: run \"make\" # then test"}]},
+	  "Tags": {"type": "multi_select", "multi_select": [{"name": "go"}, {"name": "c#"}, {"name": "a: b"}]},
+	  "Keywords": {"type": "rich_text", "rich_text": [{"plain_text": "setup, install"}]},
+	  "Draft": {"type": "checkbox", "checkbox": true},
+	  "Audience": {"type": "multi_select", "multi_select": [{"name": "devs"}, {"name": "ops"}]},
+	  "Level": {"type": "number", "number": 2}
+	}`
+	var page NotionPage
+	page.ID = "0123456789abcdef0123456789abcdef"
+	if err := json.Unmarshal([]byte(properties), &page.Properties); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(saved map[string]string, editURL bool) {
+		conf.PropertyMap, conf.NotionEditURL = saved, editURL
+	}(conf.PropertyMap, conf.NotionEditURL)
+	conf.PropertyMap = map[string]string{"Audience": "audience", "Level": "level"}
+	conf.NotionEditURL = false
+
+	titles := []string{
+		"Getting Started: Intro",
+		`Say "hi" to 'everyone'`,
+		"C# # not a comment",
+		"- starts like a list",
+		"yes",
+		"42",
+		"",
+	}
+	for _, title := range titles {
+		fm := buildFrontmatter(page, title, "/setup", 2.5)
+		out, err := renderFrontmatter(fm)
+		if err != nil {
+			t.Fatalf("renderFrontmatter(%q): %v", title, err)
+		}
+		if !strings.HasPrefix(out, "title: ") {
+			t.Errorf("title isn't the first field:\n%s", out)
+		}
+
+		var got frontmatter
+		if err := yaml.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatalf("title %q: invalid YAML: %v\n%s", title, err, out)
+		}
+		want := frontmatter{
+			Title:           title,
+			Slug:            "/setup",
+			NotionID:        page.ID,
+			Description:     `Install it: run "make" # then test`,
+			Tags:            []string{"go", "c#", "a: b"},
+			Keywords:        []string{"setup", "install"},
+			SidebarPosition: 2.5,
+			Draft:           true,
+			Extra: map[string]interface{}{
+				"audience": []interface{}{"devs", "ops"},
+				"level":    2,
+			},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("title %q: round trip = %#v, want %#v\n%s", title, got, want, out)
+		}
+	}
+}
@@ -1,3 +1,10 @@
 module github.com/rafayhingoro/nosaurus-go
 
-go 1.19
+go 1.21
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	golang.org/x/image v0.18.0
+	golang.org/x/text v0.16.0
+	gopkg.in/yaml.v3 v3.0.1
+)
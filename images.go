@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Optional optimization pass run on downloaded images. It records the image
+// dimensions and, for PNG and JPEG images wider than MaxImageWidth, writes a
+// resized copy that replaces the original in the output.
+func optimizeImage(img asset) asset {
+	if !conf.OptimizeImages {
+		return img
+	}
+
+	src := filepath.Join(conf.AssetsDir, filepath.FromSlash(img.Path))
+	f, err := os.Open(src)
+	if err != nil {
+		pageLog.Warn("failed to open image for optimization", "path", img.Path, "error", err)
+		return img
+	}
+	cfg, format, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		// Not a raster image we can decode (e.g. SVG), leave it untouched
+		return img
+	}
+
+	img.Width, img.Height = cfg.Width, cfg.Height
+	img.OrigWidth, img.OrigHeight = cfg.Width, cfg.Height
+
+	if conf.MaxImageWidth <= 0 || cfg.Width <= conf.MaxImageWidth {
+		return img
+	}
+	if format != "png" && format != "jpeg" {
+		return img
+	}
+
+	width := conf.MaxImageWidth
+	height := cfg.Height * width / cfg.Width
+	if height < 1 {
+		height = 1
+	}
+
+	// The resized copy is named after the original's hash and the target
+	// width, so later exports of the same image reuse it without re-encoding
+	ext := path.Ext(img.Path)
+	rel := fmt.Sprintf("%s-w%d%s", strings.TrimSuffix(img.Path, ext), width, ext)
+	dest := filepath.Join(conf.AssetsDir, filepath.FromSlash(rel))
+
+	if _, err := os.Stat(dest); os.IsNotExist(err) {
+		if err := resizeImage(src, dest, format, width, height); err != nil {
+			pageLog.Warn("failed to optimize image", "path", img.Path, "error", err)
+			return img
+		}
+	}
+
+	stat, err := os.Stat(dest)
+	if err != nil {
+		pageLog.Warn("failed to optimize image", "path", img.Path, "error", err)
+		return img
+	}
+
+	// Only the resized copy is published. The full size original may still
+	// be referenced elsewhere, pruning removes it once it isn't.
+	unmarkAssetReferenced(img.Path)
+	markAssetReferenced(rel)
+
+	img.Path = rel
+	img.Size = stat.Size()
+	img.Width, img.Height = width, height
+	return img
+}
+
+// Decode src, scale it to width x height and encode it to dest in the same
+// format, writing through a temp file so dest is never left half written
+func resizeImage(src string, dest string, format string, width int, height int) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	decoded, _, err := image.Decode(in)
+	if err != nil {
+		return err
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), decoded, decoded.Bounds(), draw.Src, nil)
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".optimize-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(tmp, resized, &jpeg.Options{Quality: conf.JPEGQuality})
+	default:
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(tmp, resized)
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
+
+// Render an image, with explicit dimensions when they are known so the page
+// doesn't shift while the image loads
+func renderImage(alt string, img asset) string {
+	if img.Width == 0 || img.Height == 0 {
+		return fmt.Sprintf("![%s](%s)\n\n", alt, img.URL())
+	}
+
+	attrs := fmt.Sprintf(`src="%s" alt="%s" width="%d" height="%d"`, img.URL(), mdxEscaper.Replace(alt), img.Width, img.Height)
+	if img.OrigWidth != img.Width {
+		attrs += fmt.Sprintf(` data-original-width="%d" data-original-height="%d"`, img.OrigWidth, img.OrigHeight)
+	}
+	return fmt.Sprintf("<img %s />\n\n", attrs)
+}
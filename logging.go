@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Logger of the page being rendered, its entries carry the page's ID and
+// title. Outside of rendering it is the default logger.
+var pageLog = slog.Default()
+
+// Level and format of log entries, set by setupLogging
+var logOptions struct {
+	level slog.Level
+	json  bool
+}
+
+// Log to stderr, as JSON lines when jsonOutput is set. Verbosity above 0
+// includes debug entries, below 0 only warnings and errors.
+func setupLogging(verbosity int, jsonOutput bool) {
+	logOptions.level = slog.LevelInfo
+	switch {
+	case verbosity > 0:
+		logOptions.level = slog.LevelDebug
+	case verbosity < 0:
+		logOptions.level = slog.LevelWarn
+	}
+	logOptions.json = jsonOutput
+	logTo(os.Stderr)
+}
+
+// Write log entries to w
+func logTo(w io.Writer) {
+	options := &slog.HandlerOptions{Level: logOptions.level}
+	var handler slog.Handler = slog.NewTextHandler(w, options)
+	if logOptions.json {
+		handler = slog.NewJSONHandler(w, options)
+	}
+	slog.SetDefault(slog.New(handler))
+	pageLog = slog.Default()
+}
+
+// Set the page being rendered, logged with every entry and recorded with
+// problems until the returned function is called
+func beginPage(node *docNode) func() {
+	rendering.page, rendering.err = node, nil
+	pageLog = slog.With("page_id", node.ID, "title", node.Title)
+	return func() {
+		rendering.page, rendering.blockID, rendering.err = nil, "", nil
+		pageLog = slog.Default()
+	}
+}
+
+// Log an error and exit
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
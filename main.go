@@ -1,32 +1,41 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"log"
-	"math/rand"
-	"mime"
+	"log/slog"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"text/template"
 	"time"
 
-	"github.com/BoomerangMessaging/notiongo/cache"
+	"github.com/rafayhingoro/nosaurus-go/cache"
 )
 
 // Represents the parent object (in this case, a page)
 type Parent struct {
-	Type   string `json:"type"`
-	PageID string `json:"page_id"`
+	Type       string `json:"type"`
+	PageID     string `json:"page_id"`
+	DatabaseID string `json:"database_id"`
 }
 
 // Represents the user who created/edited the block
 type User struct {
-	Object string `json:"object"`
-	ID     string `json:"id"`
+	Object    string  `json:"object"`
+	ID        string  `json:"id"`
+	Name      string  `json:"name,omitempty"`
+	AvatarURL string  `json:"avatar_url,omitempty"`
+	Person    *Person `json:"person,omitempty"`
+}
+
+type Person struct {
+	Email string `json:"email"`
 }
 
 type Mention struct {
@@ -139,13 +148,23 @@ type File struct {
 	ExpiryTime string `json:"expiry_time"`
 }
 
+// Represents a file attachment (file, pdf, video and audio blocks)
+type FileBlock struct {
+	Type     string     `json:"type"`
+	File     *File      `json:"file,omitempty"`
+	External *Link      `json:"external,omitempty"`
+	Caption  []RichText `json:"caption"`
+	Name     string     `json:"name"`
+}
+
 type Link struct {
 	URL string `json:"url"`
 }
 
 type LinkToPage struct {
-	Type   string `json:"type"`
-	PageID string `json:"page_id"`
+	Type       string `json:"type"`
+	PageID     string `json:"page_id"`
+	DatabaseID string `json:"database_id"`
 }
 type Bookmark struct {
 	URL     string     `json:"url"`
@@ -178,7 +197,10 @@ type NotionBlock struct {
 	Quote            *Quote            `json:"quote,omitempty"`
 	Callout          *Callout          `json:"callout,omitempty"`
 	Image            *Image            `json:"image,omitempty"`
-	File             *File             `json:"file,omitempty"`
+	File             *FileBlock        `json:"file,omitempty"`
+	PDF              *FileBlock        `json:"pdf,omitempty"`
+	Video            *FileBlock        `json:"video,omitempty"`
+	Audio            *FileBlock        `json:"audio,omitempty"`
 	Bookmark         *Bookmark         `json:"bookmark,omitempty"`
 	TableRows        *TableRow         `json:"table_row,omitempty"`
 	LinkToPage       *LinkToPage       `json:"link_to_page,omitempty"`
@@ -189,6 +211,19 @@ type ChildPage struct {
 	Title string `json:"title"`
 }
 
+// Returns the attachment of a file, pdf, video or audio block
+func (b NotionBlock) attachment() *FileBlock {
+	switch b.Type {
+	case "pdf":
+		return b.PDF
+	case "video":
+		return b.Video
+	case "audio":
+		return b.Audio
+	}
+	return b.File
+}
+
 type TableRowBlock struct {
 	Object         string    `json:"object"`
 	ID             string    `json:"id"`
@@ -206,9 +241,12 @@ type NotionBlockChildrenResponse struct {
 }
 
 type NotionPage struct {
-	Object     string                 `json:"object"`
-	ID         string                 `json:"id"`
-	Properties map[string]interface{} `json:"properties"`
+	Object         string              `json:"object"`
+	ID             string              `json:"id"`
+	CreatedTime    string              `json:"created_time"`
+	LastEditedTime string              `json:"last_edited_time"`
+	URL            string              `json:"url"`
+	Properties     map[string]Property `json:"properties"`
 }
 
 type NotionQueryResponse struct {
@@ -219,30 +257,67 @@ type NotionQueryResponse struct {
 
 var conf struct {
 	AssetsDir      string
-	OutputDir      string
-	APIToken       string
-	DocsRoot       string
-	slugRegistered []string
+	AssetTimeout   time.Duration
+	AssetRetries   int
+	MaxAssetSize   int64
+	OptimizeImages bool
+	MaxImageWidth  int
+	JPEGQuality    int
+	BookmarkCards  bool
+	CacheDir       string
+	PropertyMap    map[string]string
+	NotionEditURL  bool
+	PageTemplate   *template.Template
+
+	// Generated sidebars files
+	SidebarName      string
+	SidebarSort      sidebarSort
+	SidebarCollapsed bool
+
+	// Only render pages edited since the previous export
+	Incremental bool
+
+	// Treat incompletely rendered content as errors
+	Strict bool
+
+	// Sort order and filter sent with database queries
+	DatabaseSorts  []databaseSort
+	DatabaseFilter []filterCondition
+
+	OutputDir string
+	APIToken  string
+	DocsRoot  string
 }
 
-func stringExists(slice []string, str string) bool {
-	for _, v := range slice {
-		if v == str {
-			return true
+// Cache of API responses shared by the whole export
+var apiCache = cache.NewCache()
+
+// Fetch all children blocks of a block, following pagination
+func fetchAllChildren(token string, blockID string) ([]NotionBlock, error) {
+	var blocks []NotionBlock
+	cursor := ""
+	for {
+		response, err := fetchChildren(token, blockID, cursor)
+		if err != nil {
+			return nil, err
 		}
+		blocks = append(blocks, response.Results...)
+		if !response.HasMore {
+			return blocks, nil
+		}
+		cursor = response.NextCursor
 	}
-	return false
 }
 
 // Fetch children blocks of a block (pages, databases, etc.)
 func fetchChildren(token string, blockID string, cursor string) (NotionBlockChildrenResponse, error) {
 
 	url := fmt.Sprintf("https://api.notion.com/v1/blocks/%s/children?page_size=100", blockID)
+	cacheKey := url + "&start_cursor=" + cursor
 
-	cache := cache.NewCache()
 	// Try to get the response from the cache first
-	if cachedResponse, found := cache.Get(url); found {
-		fmt.Println("Cache hit:", cachedResponse)
+	if cachedResponse, found := apiCache.Get(cacheKey); found {
+		slog.Debug("cache hit", "key", cacheKey)
 		return cachedResponse.(NotionBlockChildrenResponse), nil
 	}
 
@@ -260,6 +335,7 @@ func fetchChildren(token string, blockID string, cursor string) (NotionBlockChil
 		req.URL.RawQuery = fmt.Sprintf("start_cursor=%s", cursor)
 	}
 
+	stats.APICalls++
 	resp, err := client.Do(req)
 	if err != nil {
 		return NotionBlockChildrenResponse{}, err
@@ -272,10 +348,15 @@ func fetchChildren(token string, blockID string, cursor string) (NotionBlockChil
 	}
 
 	if resp.StatusCode == 429 {
-		fmt.Println("Rate limited. Waiting for retry...")
+		stats.APIRetries++
+		emitRateLimited(3 * time.Second)
+		slog.Warn("rate limited, retrying", "url", url, "wait", 3*time.Second)
 		time.Sleep(3 * time.Second)
 		return fetchChildren(token, blockID, cursor)
 	}
+	if resp.StatusCode != http.StatusOK {
+		return NotionBlockChildrenResponse{}, fmt.Errorf("fetching children of %s: %s: %s", blockID, resp.Status, body)
+	}
 
 	var data NotionBlockChildrenResponse
 	if err := json.Unmarshal(body, &data); err != nil {
@@ -283,36 +364,54 @@ func fetchChildren(token string, blockID string, cursor string) (NotionBlockChil
 	}
 
 	// Cache the response with a 5-second TTL
-	cache.Set(url, data, 600*time.Second)
+	apiCache.Set(cacheKey, data, 600*time.Second)
 
 	return data, nil
 }
 
 // Fetch pages from a database
-func fetchPagesFromDatabase(token string, databaseID string, cursor string) (NotionQueryResponse, error) {
-	url := fmt.Sprintf("https://api.notion.com/v1/databases/%s/query", databaseID)
+func fetchPagesFromDatabase(token string, kind string, databaseID string, cursor string) (NotionQueryResponse, error) {
+	url, version := collectionEndpoint(kind, databaseID)
+	url += "/query"
+
+	query := databaseQuery{
+		StartCursor: cursor,
+		PageSize:    100,
+		Sorts:       conf.DatabaseSorts,
+	}
+	if len(conf.DatabaseFilter) > 0 {
+		db, err := fetchDatabase(token, kind, databaseID)
+		if err != nil {
+			return NotionQueryResponse{}, err
+		}
+		if query.Filter, err = buildDatabaseFilter(db, conf.DatabaseFilter); err != nil {
+			return NotionQueryResponse{}, err
+		}
+	}
+
+	reqBody, err := json.Marshal(query)
+	if err != nil {
+		return NotionQueryResponse{}, err
+	}
+	cacheKey := url + " " + string(reqBody)
 
-	cache := cache.NewCache()
 	// Try to get the response from the cache first
-	if cachedResponse, found := cache.Get(url); found {
-		fmt.Println("Cache hit:", cachedResponse)
+	if cachedResponse, found := apiCache.Get(cacheKey); found {
+		slog.Debug("cache hit", "key", cacheKey)
 		return cachedResponse.(NotionQueryResponse), nil
 	}
 
 	client := &http.Client{}
-	req, err := http.NewRequest("POST", url, nil)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(reqBody))
 	if err != nil {
 		return NotionQueryResponse{}, err
 	}
 
 	req.Header.Add("Authorization", "Bearer "+token)
-	req.Header.Add("Notion-Version", "2022-06-28")
-
-	if cursor != "" {
-		reqBody := fmt.Sprintf(`{"start_cursor":"%s"}`, cursor)
-		req.Body = io.NopCloser(strings.NewReader(reqBody))
-	}
+	req.Header.Add("Notion-Version", version)
+	req.Header.Add("Content-Type", "application/json")
 
+	stats.APICalls++
 	resp, err := client.Do(req)
 	if err != nil {
 		return NotionQueryResponse{}, err
@@ -325,9 +424,14 @@ func fetchPagesFromDatabase(token string, databaseID string, cursor string) (Not
 	}
 
 	if resp.StatusCode == 429 {
-		fmt.Println("Rate limited. Waiting for retry...")
+		stats.APIRetries++
+		emitRateLimited(3 * time.Second)
+		slog.Warn("rate limited, retrying", "url", url, "wait", 3*time.Second)
 		time.Sleep(3 * time.Second)
-		return fetchPagesFromDatabase(token, databaseID, cursor)
+		return fetchPagesFromDatabase(token, kind, databaseID, cursor)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return NotionQueryResponse{}, fmt.Errorf("querying %s %s: %s: %s", kind, databaseID, resp.Status, body)
 	}
 
 	var data NotionQueryResponse
@@ -336,7 +440,7 @@ func fetchPagesFromDatabase(token string, databaseID string, cursor string) (Not
 	}
 
 	// Cache the response with a 5-second TTL
-	cache.Set(url, data, 600*time.Second)
+	apiCache.Set(cacheKey, data, 600*time.Second)
 
 	return data, nil
 }
@@ -364,11 +468,11 @@ func namedDirOrFileExists(rootDir, name string) (bool, error) {
 // Fetch content of a page by retrieving its blocks
 func fetchPage(token string, pageID string) (*NotionPage, error) {
 	url := fmt.Sprintf("https://api.notion.com/v1/pages/%s", pageID)
+	cacheKey := url
 
-	cache := cache.NewCache()
 	// Try to get the response from the cache first
-	if cachedResponse, found := cache.Get(url); found {
-		fmt.Println("Cache hit:", cachedResponse)
+	if cachedResponse, found := apiCache.Get(cacheKey); found {
+		slog.Debug("cache hit", "key", cacheKey)
 		return cachedResponse.(*NotionPage), nil
 	}
 
@@ -381,6 +485,7 @@ func fetchPage(token string, pageID string) (*NotionPage, error) {
 	req.Header.Add("Authorization", "Bearer "+token)
 	req.Header.Add("Notion-Version", "2022-06-28")
 
+	stats.APICalls++
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -393,10 +498,15 @@ func fetchPage(token string, pageID string) (*NotionPage, error) {
 	}
 
 	if resp.StatusCode == 429 {
-		fmt.Println("Rate limited. Waiting for retry...")
+		stats.APIRetries++
+		emitRateLimited(3 * time.Second)
+		slog.Warn("rate limited, retrying", "url", url, "wait", 3*time.Second)
 		time.Sleep(3 * time.Second)
 		return fetchPage(token, pageID)
 	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching page %s: %s: %s", pageID, resp.Status, body)
+	}
 
 	var response NotionPage
 	if err := json.Unmarshal(body, &response); err != nil {
@@ -404,7 +514,7 @@ func fetchPage(token string, pageID string) (*NotionPage, error) {
 	}
 
 	// Cache the response with a 5-second TTL
-	cache.Set(url, response, 600*time.Second)
+	apiCache.Set(cacheKey, &response, 600*time.Second)
 
 	return &response, nil
 }
@@ -412,11 +522,11 @@ func fetchPage(token string, pageID string) (*NotionPage, error) {
 // Fetch content of a page by retrieving its blocks
 func fetchPageContent(token string, pageID string) ([]NotionBlock, error) {
 	url := fmt.Sprintf("https://api.notion.com/v1/blocks/%s/children", pageID)
+	cacheKey := url
 
-	cache := cache.NewCache()
 	// Try to get the response from the cache first
-	if cachedResponse, found := cache.Get(url); found {
-		fmt.Println("Cache hit:", cachedResponse)
+	if cachedResponse, found := apiCache.Get(cacheKey); found {
+		slog.Debug("cache hit", "key", cacheKey)
 		return cachedResponse.([]NotionBlock), nil
 	}
 
@@ -429,6 +539,7 @@ func fetchPageContent(token string, pageID string) ([]NotionBlock, error) {
 	req.Header.Add("Authorization", "Bearer "+token)
 	req.Header.Add("Notion-Version", "2022-06-28")
 
+	stats.APICalls++
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -441,10 +552,15 @@ func fetchPageContent(token string, pageID string) ([]NotionBlock, error) {
 	}
 
 	if resp.StatusCode == 429 {
-		fmt.Println("Rate limited. Waiting for retry...")
+		stats.APIRetries++
+		emitRateLimited(3 * time.Second)
+		slog.Warn("rate limited, retrying", "url", url, "wait", 3*time.Second)
 		time.Sleep(3 * time.Second)
 		return fetchPageContent(token, pageID)
 	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching content of %s: %s: %s", pageID, resp.Status, body)
+	}
 
 	var response NotionBlockChildrenResponse
 	if err := json.Unmarshal(body, &response); err != nil {
@@ -452,63 +568,11 @@ func fetchPageContent(token string, pageID string) ([]NotionBlock, error) {
 	}
 
 	// Cache the response with a 5-second TTL
-	cache.Set(url, response.Results, 600*time.Second)
+	apiCache.Set(cacheKey, response.Results, 600*time.Second)
 
 	return response.Results, nil
 }
 
-func randomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	result := make([]byte, length)
-	for i := range result {
-		result[i] = charset[rand.Intn(len(charset))]
-	}
-	return string(result)
-}
-
-func downloadImage(url string, filepath string) (string, error) {
-	// Make the HTTP request to download the image
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	// Check if the request was successful
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to download image: status code %d", resp.StatusCode)
-	}
-
-	// Get the Content-Type header to determine the file extension
-	contentType := resp.Header.Get("Content-Type")
-	exts, err := mime.ExtensionsByType(contentType)
-	if err != nil || len(exts) == 0 {
-		return "", fmt.Errorf("failed to determine file extension for content type: %s", contentType)
-	}
-
-	// Create a unique file name with random string and timestamp
-	timestamp := time.Now().UnixNano()
-	randomStr := randomString(8)
-	filename := fmt.Sprintf("%s_%d%s", randomStr, timestamp, exts[0])
-
-	img := fmt.Sprintf("%s/%s", filepath, filename)
-
-	// Create the file with the appropriate extension
-	out, err := os.Create(img)
-	if err != nil {
-		return "", err
-	}
-	defer out.Close()
-
-	// Copy the image data to the file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	return filename, nil
-}
-
 func formatBlockHTML(rt RichText) string {
 
 	rt.PlainText = strings.ReplaceAll(rt.PlainText, "·", "-")
@@ -535,26 +599,84 @@ func formatBlockHTML(rt RichText) string {
 
 }
 
+// Render a file attachment as a link with its caption and size. Notion-hosted
+// files are downloaded since their signed URLs expire within an hour.
+func renderAttachment(f *FileBlock) string {
+	if f == nil {
+		return ""
+	}
+
+	caption := ""
+	for _, t := range f.Caption {
+		caption += formatBlockHTML(t)
+	}
+
+	var link string
+	switch f.Type {
+	case "file":
+		file, err := downloadFile(f.File.URL, f.Name)
+		if err != nil {
+			reportProblem(problemAssetFailed, "failed to download file", "url", f.File.URL, "error", err)
+			stats.AssetsFailed++
+			return fmt.Sprintf("[%s](%s)  \n", fileNameFromURL(f.File.URL), f.File.URL)
+		}
+		link = fmt.Sprintf("[%s](%s) (%s)", path.Base(file.Path), file.URL(), humanSize(file.Size))
+	case "external":
+		link = fmt.Sprintf("[%s](%s)", fileNameFromURL(f.External.URL), f.External.URL)
+	default:
+		return ""
+	}
+
+	if caption != "" {
+		link += " - " + caption
+	}
+	return link + "  \n"
+}
+
+// Block types blocksToMarkdown renders, anything else is written as an
+// unsupported block placeholder
+var renderedBlocks = map[string]bool{
+	"paragraph":          true,
+	"heading_1":          true,
+	"heading_2":          true,
+	"heading_3":          true,
+	"bulleted_list_item": true,
+	"numbered_list_item": true,
+	"to_do":              true,
+	"table":              true,
+	"table_row":          true,
+	"divider":            true,
+	"code":               true,
+	"quote":              true,
+	"callout":            true,
+	"image":              true,
+	"file":               true,
+	"pdf":                true,
+	"video":              true,
+	"audio":              true,
+	"bookmark":           true,
+	"link_to_page":       true,
+}
+
 // Convert Notion blocks to Markdown content
 func blocksToMarkdown(token string, blocks []NotionBlock, isChildren bool) string {
 	var markdownBuilder strings.Builder
 
 	for _, block := range blocks {
+		rendering.blockID = block.ID
 		var plainText string
 		switch block.Type {
 		case "paragraph":
 			for _, t := range block.Paragraph.RichText {
-				if t.Type == "mention" {
+				// User, date and database mentions are kept as plain text
+				if t.Type == "mention" && t.Mention.Type == "page" {
 					page, err := fetchPage(token, t.Mention.Page.ID)
 					if err != nil {
-						log.Printf("[ERROR] while fetching mention_to_page %v", err)
+						reportProblem(problemUnresolvedLink, "failed to fetch mentioned page "+t.Mention.Page.ID, "error", err)
 						continue
 					} else {
-						title, slug, _ := extractPageProperties(*page)
-						if len(slug) > 0 && slug[0:1] == "/" {
-							slug = conf.DocsRoot + slug
-						}
-						plainText += fmt.Sprintf("[%s](%s)", title, slug)
+						title, link := pageLink(*page)
+						plainText += fmt.Sprintf("[%s](%s)", title, link)
 					}
 				} else {
 					plainText += formatBlockHTML(t)
@@ -590,8 +712,8 @@ func blocksToMarkdown(token string, blocks []NotionBlock, isChildren bool) strin
 		case "table":
 			tableRows, err := fetchTableContent(token, block.ID)
 			if err != nil {
-				log.Printf("Error fetching table content: %v", err)
-				markdownBuilder.WriteString("[Error: Could not fetch table content]\n")
+				reportProblem(problemUnresolvedLink, "failed to fetch table rows", "error", err)
+				failRendering(fmt.Errorf("fetching table rows of %s: %v", block.ID, err))
 			} else {
 				markdownBuilder.WriteString(renderTable(block.Table, tableRows) + "  \n")
 			}
@@ -649,54 +771,49 @@ func blocksToMarkdown(token string, blocks []NotionBlock, isChildren bool) strin
 			} else if block.Image.Type == "external" {
 				url = block.Image.External.URL
 			}
-			staticDir := fmt.Sprintf("%s/docs-images", conf.AssetsDir)
 
-			if _, err := os.Stat(staticDir); os.IsNotExist(err) {
-				if err := os.MkdirAll(staticDir, os.ModePerm); err != nil {
-					log.Println("failed to create subdirectory ", err)
-				}
-			}
-
-			filename, err := downloadImage(url, staticDir)
+			img, err := downloadImage(url)
 			if err != nil {
-				log.Println("error occured while downloading image", err)
+				reportProblem(problemAssetFailed, "failed to download image", "url", url, "error", err)
+				stats.AssetsFailed++
+				markdownBuilder.WriteString(fmt.Sprintf("![%s](%s)\n\n", caption, url))
 			} else {
-				caption = filename
-				url = fmt.Sprintf("/docs-images/%s", filename)
+				img = optimizeImage(img)
+				caption = path.Base(img.Path)
+				markdownBuilder.WriteString(renderImage(caption, img))
 			}
-
-			markdownBuilder.WriteString(fmt.Sprintf("![%s](%s)\n\n", caption, url))
-		case "file":
-			markdownBuilder.WriteString(fmt.Sprintf("[File](%s)  \n", block.File.URL))
+		case "file", "pdf", "video", "audio":
+			markdownBuilder.WriteString(renderAttachment(block.attachment()))
 		case "bookmark":
-			caption := ""
-			for _, t := range block.Bookmark.Caption {
-				caption += t.PlainText
-			}
-			markdownBuilder.WriteString(fmt.Sprintf("[%s](%s)  \n", caption, block.Bookmark.URL))
+			markdownBuilder.WriteString(renderBookmark(block.Bookmark))
 		case "link_to_page":
+			// Links to databases have no page to point to
+			if block.LinkToPage.Type != "page_id" {
+				reportProblem(problemUnresolvedLink, "link to database "+block.LinkToPage.DatabaseID+" has no page to point to")
+				continue
+			}
 			page, err := fetchPage(token, block.LinkToPage.PageID)
 			if err != nil {
-				log.Printf("[ERROR] while fetching link_to_page %v", err)
+				reportProblem(problemUnresolvedLink, "failed to fetch linked page "+block.LinkToPage.PageID, "error", err)
 				continue
 			} else {
-				title, slug, _ := extractPageProperties(*page)
-
-				if len(slug) > 0 && slug[0:1] == "/" {
-					slug = conf.DocsRoot + slug
-				}
-
-				markdownBuilder.WriteString(fmt.Sprintf("[%s](%s)<br/>", title, slug))
+				title, link := pageLink(*page)
+				markdownBuilder.WriteString(fmt.Sprintf("[%s](%s)<br/>", title, link))
 			}
 		case "unsupported":
+			stats.UnsupportedBlocks[block.Type]++
+			reportProblem(problemUnsupportedBlock, "block type not supported by the API")
 		default:
+			stats.UnsupportedBlocks[block.Type]++
+			reportProblem(problemUnsupportedBlock, "unsupported block type "+block.Type)
 			markdownBuilder.WriteString(fmt.Sprintf("[Unsupported block type: %s]  \n", block.Type))
 		}
 
 		if block.HasChildren {
 			blocks, err := fetchPageContent(token, block.ID)
 			if err != nil {
-				log.Println("[ERROR] failed to fetch ")
+				reportProblem(problemUnresolvedLink, "failed to fetch child blocks", "error", err)
+				failRendering(fmt.Errorf("fetching child blocks of %s: %v", block.ID, err))
 			} else {
 				// Convert blocks to markdown content
 				contentMarkdown := blocksToMarkdown(token, blocks, true)
@@ -764,17 +881,14 @@ func renderTableCell(cell []TableCell) string {
 	var cellContent string
 	for _, rt := range cell {
 
-		if rt.Type == "mention" {
+		if rt.Type == "mention" && rt.Mention.Type == "page" {
 			page, err := fetchPage(conf.APIToken, rt.Mention.Page.ID)
 			if err != nil {
-				log.Printf("[ERROR] while fetching mention_to_page %v", err)
+				reportProblem(problemUnresolvedLink, "failed to fetch mentioned page "+rt.Mention.Page.ID, "error", err)
 				continue
 			} else {
-				title, slug, _ := extractPageProperties(*page)
-				if len(slug) > 0 && slug[0:1] == "/" {
-					slug = conf.DocsRoot + slug
-				}
-				rt.PlainText = fmt.Sprintf("[%s](%s)", title, slug)
+				title, link := pageLink(*page)
+				rt.PlainText = fmt.Sprintf("[%s](%s)", title, link)
 			}
 		}
 
@@ -810,55 +924,9 @@ func renderTableCell(cell []TableCell) string {
 	return cellContent
 }
 
-// Helper function to extract property values from a page
-func extractPageProperties(page NotionPage) (title string, slug string, keywords string) {
-	// Title
-	if titleProp, ok := page.Properties["Name"].(map[string]interface{}); ok {
-		title = titleProp["title"].([]interface{})[0].(map[string]interface{})["plain_text"].(string)
-	}
-
-	// Slug
-	if slugProp, ok := page.Properties["Slug"].(map[string]interface{}); ok {
-		slug = title
-		if len(slugProp["rich_text"].([]interface{})) > 0 {
-			slug = slugProp["rich_text"].([]interface{})[0].(map[string]interface{})["plain_text"].(string)
-
-		}
-		slug = strings.ReplaceAll(slug, " ", "-")
-	}
-
-	// Keywords
-	if keywordsProp, ok := page.Properties["Keywords"].(map[string]interface{}); ok {
-		keywords = ""
-		if len(keywordsProp["rich_text"].([]interface{})) > 0 {
-			keywords = keywordsProp["rich_text"].([]interface{})[0].(map[string]interface{})["plain_text"].(string)
-		}
-	}
-
-	return title, slug, keywords
-}
-
-func extractPageRelations(page NotionPage) (parentId string, childPages []string) {
-
-	if parent, ok := page.Properties["Parent"].(map[string]interface{}); ok {
-		if len(parent["relation"].([]interface{})) > 0 {
-			parentId = parent["relation"].([]interface{})[0].(map[string]interface{})["id"].(string)
-		}
-	}
-	if subItems, ok := page.Properties["Sub-Items"].(map[string]interface{}); ok {
-		if len(subItems["relation"].([]interface{})) > 0 {
-			for _, item := range subItems["relation"].([]interface{}) {
-				childPages = append(childPages, item.(map[string]interface{})["id"].(string))
-			}
-		}
-	}
-
-	return parentId, childPages
-}
-
 // Convert a page to markdown, including content
-func pageToMarkdown(token string, page NotionPage, position int) (string, error) {
-	title, slug, keywords := extractPageProperties(page)
+func pageToMarkdown(token string, node *docNode) (string, error) {
+	page := *node.Page
 
 	// Fetch page content (blocks)
 	blocks, err := fetchPageContent(token, page.ID)
@@ -868,127 +936,73 @@ func pageToMarkdown(token string, page NotionPage, position int) (string, error)
 
 	// Convert blocks to markdown content
 	contentMarkdown := blocksToMarkdown(token, blocks, false)
-
-	// Format keywords for markdown
-	keywordString := "[" + keywords + "]"
-
-	slug = strings.ReplaceAll(slug, "(", "")
-	slug = strings.ReplaceAll(slug, ")", "")
-
-	if stringExists(conf.slugRegistered, slug) {
-		slug += "-dup"
+	if rendering.err != nil {
+		return "", rendering.err
 	}
-	conf.slugRegistered = append(conf.slugRegistered, slug)
-
-	// Template for markdown output
-	return fmt.Sprintf(`---
-title: %s
-slug: %s
-tags: %s
-sidebar_position: %d
----
-
-%s
-`, title, slug, keywordString, position, contentMarkdown), nil
-}
 
-// Write markdown to file
-func writeMarkdown(outputDir string, token string, page NotionPage, position int) error {
-	markdown, err := pageToMarkdown(token, page, position)
+	// Problems with frontmatter properties don't belong to any block
+	rendering.blockID = ""
+	frontmatter, err := renderFrontmatter(buildFrontmatter(page, node.Title, node.Slug, node.Position))
 	if err != nil {
-		return err
-	}
-	// title, _, _ := extractPageProperties(page)
-
-	// sub := strings.Split(slug, "/")
-	dir := outputDir
-
-	_, childPages := extractPageRelations(page)
-	// if parent != "" {
-	// 	dir = fmt.Sprintf("%s/%s", dir, parent)
-	// 	fmt.Printf("directory to be created %s\n", dir)
-	// 	if _, err := os.Stat(dir); os.IsNotExist(err) {
-	// 		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-	// 			log.Println("failed to create subdirectory ", err)
-	// 		}
-	// 	}
-	// }
-
-	HasChildren := false
-	if len(childPages) > 0 {
-		dir = fmt.Sprintf("%s/%s", dir, page.ID)
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
-			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-				log.Println("failed to create subdirectory ", err)
-			}
-		}
-		for cPageIndex, child := range childPages {
-			childPage, err := fetchPage(token, child)
-			if err != nil {
-				fmt.Printf("failed to fetch child id %s", child)
-			} else {
-				if err := writeMarkdown(dir, token, *childPage, cPageIndex); err != nil {
-					fmt.Printf("failed to write markdown for child page %s", childPage.ID)
-					continue
-				}
-				HasChildren = true
-			}
-		}
-	}
-
-	title, _, _ := extractPageProperties(page)
-	title = strings.ReplaceAll(title, `\`, `\\`)
-	title = strings.ReplaceAll(title, `"`, `\"`)
-	title = strings.ReplaceAll(title, "\n", `\n`)
-	title = strings.ReplaceAll(title, "\t", `\t`)
-	title = strings.ReplaceAll(title, "\r", `\r`)
-	title = strings.ReplaceAll(title, "\b", `\b`)
-	title = strings.ReplaceAll(title, "\f", `\f`)
-
-	categoryJson := fmt.Sprintf(`{
-	"label": "%s",
-	"position": %d
-}`, title, position)
-
-	pagename := page.ID
-	if HasChildren {
-		pagename = "index"
-		os.WriteFile(fmt.Sprintf("%s/_category_.json", dir), []byte(categoryJson), 0644)
+		return "", err
 	}
 
-	filePath := fmt.Sprintf("%s/%s.md", dir, pagename)
-
-	return os.WriteFile(filePath, []byte(markdown), 0644)
+	created, _ := parseNotionTime(page.CreatedTime)
+	lastEdited, _ := parseNotionTime(page.LastEditedTime)
+
+	return renderPageTemplate(pageTemplateData{
+		Page:           page,
+		Properties:     page.Properties,
+		Title:          node.Title,
+		Slug:           node.Slug,
+		Position:       node.Position,
+		Frontmatter:    frontmatter,
+		Body:           contentMarkdown,
+		Breadcrumbs:    node.trail(),
+		Children:       node.childRefs(),
+		CreatedTime:    created,
+		LastEditedTime: lastEdited,
+	})
 }
 
-// Process blocks recursively
-func processBlocks(token string, blockID string, outputDir string) {
+// Process blocks recursively, adding the pages they link to below parent
+func processBlocks(token string, blockID string, parent *docNode) error {
 	var nextCursor string
 	hasMore := true
 
+	// Positions continue across result pages so they are unique per parent
+	index := 0
+
 	for hasMore {
 		response, err := fetchChildren(token, blockID, nextCursor)
 		if err != nil {
-			log.Fatalf("Failed to fetch children: %v", err)
+			return err
 		}
 
-		for index, block := range response.Results {
+		for _, block := range response.Results {
+			index++
 
 			switch block.Type {
 			case "link_to_page":
+				if block.LinkToPage.Type != "page_id" {
+					continue
+				}
 				page, err := fetchPage(token, block.LinkToPage.PageID)
 				if err != nil {
-					log.Println("failed to fetch page id: ", block.LinkToPage.PageID)
+					stats.PagesFailed++
+					parent.exportRoot().incomplete = true
+					slog.Error("failed to fetch linked page", "block_id", block.ID, "linked_id", block.LinkToPage.PageID, "error", err)
 					continue
 				}
-				log.Println("FETCHING PAGE", page.ID)
-				writeMarkdown(outputDir, token, *page, index)
+				slog.Debug("found linked page", "page_id", page.ID, "block_id", block.ID)
+				discoverPage(token, *page, parent, float64(index))
 			case "child_page":
 				if block.HasChildren {
-					subOutput := outputDir + "/" + block.ChildPage.Title
-					os.MkdirAll(subOutput, 0755)
-					processBlocks(token, block.ID, subOutput)
-
+					node := &docNode{ID: block.ID, Title: block.ChildPage.Title, Position: float64(index)}
+					parent.addChild(node)
+					if err := processBlocks(token, block.ID, node); err != nil {
+						return err
+					}
 				}
 			}
 
@@ -1010,54 +1024,259 @@ func processBlocks(token string, blockID string, outputDir string) {
 		nextCursor = response.NextCursor
 		time.Sleep(1 * time.Second)
 	}
+	return nil
 }
 
-// Process pages in a database
-func processDatabases(token string, databaseID string, outputDir string) {
+// Process pages in a database, adding them below parent
+func processDatabases(token string, kind string, databaseID string, parent *docNode) error {
 	var nextCursor string
 	hasMore := true
 
+	// Results come in the configured sort order, number them across all
+	// result pages rather than restarting on every page
+	index := 0
+
 	for hasMore {
-		response, err := fetchPagesFromDatabase(token, databaseID, nextCursor)
+		response, err := fetchPagesFromDatabase(token, kind, databaseID, nextCursor)
 		if err != nil {
-			log.Fatalf("Failed to fetch pages from database: %v", err)
+			return err
 		}
 
-		for index, page := range response.Results {
-			fmt.Printf("Writing markdown for page: %s\n", page.ID)
-			if err := writeMarkdown(outputDir, token, page, index); err != nil {
-				log.Printf("Failed to write markdown for page %s: %v", page.ID, err)
-			}
+		for _, page := range response.Results {
+			index++
+			slog.Debug("found database page", "page_id", page.ID, "database_id", databaseID)
+			discoverPage(token, page, parent, float64(index))
 		}
 
 		hasMore = response.HasMore
 		nextCursor = response.NextCursor
 		time.Sleep(1 * time.Second)
 	}
+	return nil
 }
 
-func main() {
-	token := flag.String("t", "", "Notion API token")
-	rootID := flag.String("r", "", "Root block ID (page or database)")
-	outputDir := flag.String("o", "./output", "Output directory for markdown files")
-	DocsRoot := flag.String("docs", "/docs", "root docs directory")
-	AssetsRoot := flag.String("assets", "./static", "root docs directory")
+// Export the trees below roots to their output directories. Files are named
+// after page slugs, the manifest of the previous export keeps names stable
+// and lets renamed pages move instead of leaving their old file behind.
+// Returns the previous manifests of roots, in the same order.
+func exportTree(token string, roots []*exportRoot) []*manifest {
+	// Lay out every root before writing any page, so links between roots
+	// resolve to their final URLs
+	previous := make([]*manifest, len(roots))
+	for i, r := range roots {
+		previous[i] = loadManifest(r.OutputDir)
+		assignPaths(r.node, previous[i])
+		resolveSlugs(r.node)
+	}
+
+	if conf.Incremental {
+		for i, r := range roots {
+			if previous[i].layoutChanged(r) {
+				slog.Info("pages were added, moved or removed, rendering all pages", "output", r.OutputDir)
+				conf.Incremental = false
+				break
+			}
+		}
+	}
+
+	emit(eventRenderStarted)
+	for i, r := range roots {
+		r.use()
+		if _, err := os.Stat(r.OutputDir); os.IsNotExist(err) {
+			output.MkdirAll(r.OutputDir)
+		}
+
+		written := newManifest()
+		writeTree(token, r.OutputDir, r.node, written, previous[i])
+
+		// Keep entries of pages that failed this time so their files are
+		// still tracked, along with the assets those files link to. Pages
+		// no longer found are only known to be gone if nothing failed to be
+		// fetched.
+		for id, entry := range previous[i].Pages {
+			if _, ok := written.Pages[id]; ok {
+				continue
+			}
+			node, found := discovered[id]
+			if found && node.exportRoot() == r || !found && r.incomplete {
+				written.Pages[id] = entry
+				for _, rel := range entry.Assets {
+					markAssetReferenced(rel)
+				}
+			}
+		}
 
-	flag.Parse()
+		removeStalePages(r.OutputDir, previous[i], written)
+		if err := written.save(r.OutputDir); err != nil {
+			slog.Error("failed to write manifest", "output", r.OutputDir, "error", err)
+		}
+	}
+	return previous
+}
 
-	if *token == "" || *rootID == "" {
-		log.Fatal("Notion API token and root ID are required")
+// Settings shared by all commands
+type settings struct {
+	Token       string
+	Roots       []*exportRoot
+	PruneAssets bool
+	SummaryJSON string
+	Threshold   int // warnings allowed before failing, negative for any
+	Strict      bool
+	DryRun      bool
+	Diff        bool
+	Progress    string        // -progress mode
+	Interval    time.Duration // between checks for edits in watch mode
+	Args        []string      // positional arguments
+}
+
+// Parse the flags of a command, merged with the environment and the config
+// file, into conf and the returned settings
+func configure(command string, args []string) *settings {
+	flags := flag.NewFlagSet("nosaurus-go "+command, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: nosaurus-go %s [flags]%s\n\nFlags:\n", command, commandArgs[command])
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", "", "YAML or TOML config file, nosaurus.yaml, nosaurus.yml or nosaurus.toml when present")
+	token := flags.String("t", "", "Notion API token, NOTION_TOKEN by default")
+	rootID := flags.String("r", "", "root page, database or data source, as an ID or a Notion URL")
+	outputDir := flags.String("o", "./output", "Output directory for markdown files")
+	DocsRoot := flags.String("docs", "/docs", "root docs directory")
+	AssetsRoot := flags.String("assets", "./static", "root docs directory")
+	assetTimeout := flags.Duration("asset-timeout", 60*time.Second, "timeout for downloading a single asset")
+	assetRetries := flags.Int("asset-retries", 3, "number of times a failed asset download is retried")
+	maxAssetSize := flags.Int64("max-asset-size", 100, "maximum size of a downloaded asset in MB, 0 for no limit")
+	optimizeImages := flags.Bool("optimize-images", false, "resize downloaded images wider than -max-image-width and emit their dimensions")
+	maxImageWidth := flags.Int("max-image-width", 1600, "maximum width in pixels of optimized images")
+	jpegQuality := flags.Int("jpeg-quality", 85, "quality (1-100) used when re-encoding JPEG images")
+	bookmarkCards := flags.Bool("bookmark-cards", false, "render bookmarks as cards with the target page's title, description and favicon")
+	cacheDir := flags.String("cache-dir", "./.nosaurus-cache", "directory for data cached between runs")
+	propertyMap := flags.String("props", "", "database property mapping as comma separated Property=role pairs, roles are title, slug, keywords, tags, description, image, draft, hide_table_of_contents, last_update, custom_edit_url, collapsed, collapsible, class_name, category_link, position, parent, children or any other frontmatter field name")
+	notionEditURL := flags.Bool("notion-edit-url", false, "link the \"Edit this page\" button to the page in Notion unless custom_edit_url is mapped")
+	templatePath := flags.String("template", "", "path to a Go text/template used to render page files")
+	sidebarsFile := flags.String("sidebars", "", "write a sidebars.js or sidebars.ts file mirroring the Notion hierarchy to this path")
+	sidebarName := flags.String("sidebar-name", "docs", "name of the sidebar in the generated sidebars file")
+	sidebarIDPrefix := flags.String("sidebar-id-prefix", "", "prefix added to doc IDs in the sidebars file and category links, e.g. \"notion/\" when -o is a subdirectory of the docs directory. Roots given with -root set their own with idprefix")
+	sidebarSortBy := flags.String("sidebar-sort", "", "order sidebar items by this property, append :desc for descending order")
+	sidebarCollapsed := flags.Bool("sidebar-collapsed", true, "collapse sidebar categories by default, a page's collapsed property takes precedence")
+	databaseSorts := flags.String("db-sort", "", "sort database pages by comma separated Property[:asc|desc] items, created_time and last_edited_time sort by page timestamps")
+	databaseFilter := flags.String("db-filter", "", "only export database pages matching all comma separated Property=Value or Property!=Value conditions, e.g. Status=Published,Public=true, people and relation properties are matched by user or page ID")
+	var rootSpecs rootFlags
+	flags.Var(&rootSpecs, "root", "additional root to export, as comma separated id=ID or URL,out=DIR,docs=ROUTE,assets=DIR,sidebars=FILE,idprefix=PREFIX settings, can be repeated")
+	verbose := flags.Bool("v", false, "verbose, also log debug messages")
+	quiet := flags.Bool("q", false, "quiet, only log warnings and errors")
+	logJSON := flags.Bool("log-json", false, "log JSON lines instead of text")
+	progressMode := flags.String("progress", progressAuto, "show export progress: bar, lines (logged every 10s), off, or auto for a bar when stderr is a terminal and lines otherwise")
+	strict := flags.Bool("strict", false, "fail the export on unsupported blocks, unresolved links and failed asset downloads, same as -strict-threshold 0")
+	summaryJSON := flags.String("summary-json", "", "also write the summary of the run as JSON to this file, - for stdout, which moves the text output to stderr")
+	strictThreshold := flags.Int("strict-threshold", -1, "exit with code 3 when there are more problems (unsupported blocks, unresolved links, failed assets) than this, negative to allow any number")
+	dryRun := flags.Bool("dry-run", false, "render everything without writing, and list the files that would be created, modified or deleted")
+	diff := flags.Bool("diff", false, "also print unified diffs of the changed files")
+	pollInterval := flags.Duration("poll-interval", 30*time.Second, "time between checks for edits in Notion when watching")
+	pruneStale := flags.Bool("prune-assets", true, "remove assets downloaded by previous exports that are no longer referenced")
+
+	flags.Parse(args)
+
+	// Command line flags take precedence over the environment, which takes
+	// precedence over the config file
+	if err := applyConfig(flags, *configPath); err != nil {
+		fatal("invalid configuration", "error", err)
 	}
 
-	if _, err := os.Stat(*outputDir); os.IsNotExist(err) {
-		os.MkdirAll(*outputDir, os.ModePerm)
+	verbosity := 0
+	if *verbose {
+		verbosity++
 	}
+	if *quiet {
+		verbosity--
+	}
+	setupLogging(verbosity, *logJSON)
 
-	conf.DocsRoot = *DocsRoot
-	conf.AssetsDir = *AssetsRoot
+	mode, err := parseProgressMode(*progressMode)
+	if err != nil {
+		fatal("invalid -progress", "error", err)
+	}
+
+	if *assetRetries < 0 {
+		fatal("invalid -asset-retries, it can't be negative", "asset_retries", *assetRetries)
+	}
+	conf.AssetTimeout = *assetTimeout
+	conf.AssetRetries = *assetRetries
+	conf.MaxAssetSize = *maxAssetSize << 20
+	conf.OptimizeImages = *optimizeImages
+	conf.MaxImageWidth = *maxImageWidth
+	conf.JPEGQuality = *jpegQuality
+	conf.BookmarkCards = *bookmarkCards
+	conf.CacheDir = *cacheDir
+
+	mapping, err := parsePropertyMap(*propertyMap)
+	if err != nil {
+		fatal("invalid -props", "error", err)
+	}
+	conf.PropertyMap = mapping
+	conf.NotionEditURL = *notionEditURL
+
+	pageTemplate, err := loadPageTemplate(*templatePath)
+	if err != nil {
+		fatal("invalid -template", "error", err)
+	}
+	conf.PageTemplate = pageTemplate
+	conf.SidebarName = *sidebarName
+	conf.SidebarSort = parseSidebarSort(*sidebarSortBy)
+	conf.SidebarCollapsed = *sidebarCollapsed
+
+	sorts, err := parseDatabaseSorts(*databaseSorts)
+	if err != nil {
+		fatal("invalid -db-sort", "error", err)
+	}
+	conf.DatabaseSorts = sorts
+
+	filter, err := parseDatabaseFilter(*databaseFilter)
+	if err != nil {
+		fatal("invalid -db-filter", "error", err)
+	}
+	conf.DatabaseFilter = filter
+	conf.Strict = *strict
 	conf.APIToken = *token
 
-	processBlocks(*token, *rootID, *outputDir)
+	// -r, -o, -docs, -assets and -sidebars describe a single root, and are
+	// the defaults for the settings a -root leaves out
+	defaults := exportRoot{
+		Spec:      *rootID,
+		OutputDir: *outputDir,
+		DocsRoot:  *DocsRoot,
+		AssetsDir: *AssetsRoot,
+		Sidebars:  *sidebarsFile,
+		IDPrefix:  *sidebarIDPrefix,
+	}
+	var roots []*exportRoot
+	if *rootID != "" {
+		roots = append(roots, &defaults)
+	}
+	outputs := map[string]bool{filepath.Clean(*outputDir): *rootID != ""}
+	for _, spec := range rootSpecs {
+		r, err := parseRootSpec(spec, defaults)
+		if err != nil {
+			fatal("invalid -root", "error", err)
+		}
+		if outputs[filepath.Clean(r.OutputDir)] {
+			fatal("invalid -root, output directory is used by another root", "output", r.OutputDir)
+		}
+		outputs[filepath.Clean(r.OutputDir)] = true
+		roots = append(roots, r)
+	}
 
-	fmt.Println("Export completed successfully.")
+	return &settings{
+		Token:       *token,
+		Roots:       roots,
+		PruneAssets: *pruneStale,
+		SummaryJSON: *summaryJSON,
+		Threshold:   *strictThreshold,
+		Strict:      *strict,
+		DryRun:      *dryRun,
+		Diff:        *diff,
+		Progress:    mode,
+		Interval:    *pollInterval,
+		Args:        flags.Args(),
+	}
 }
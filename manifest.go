@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File in the output directory recording where each page was written, used
+// to move files when pages are renamed in Notion
+const manifestFile = ".nosaurus-manifest.json"
+
+// Manifests before version 1 don't list the assets of pages
+const manifestVersion = 1
+
+type manifest struct {
+	Version int                     `json:"version"`
+	Pages   map[string]manifestPage `json:"pages"` // by page ID
+}
+
+type manifestPage struct {
+	Path           string   `json:"path"` // relative to the output directory, slash separated
+	Title          string   `json:"title"`
+	LastEditedTime string   `json:"last_edited_time"`
+	Assets         []string `json:"assets,omitempty"` // relative to AssetsDir
+
+	// Notion rounds edit times down to the minute, so further edits in the
+	// minute the page was exported in don't change its time. Such pages are
+	// rendered again by the next export.
+	Unsettled bool `json:"unsettled,omitempty"`
+}
+
+func newManifest() *manifest {
+	return &manifest{Version: manifestVersion, Pages: make(map[string]manifestPage)}
+}
+
+// Load the manifest of the previous export, an empty one if there is none
+func loadManifest(outputDir string) *manifest {
+	m := newManifest()
+	data, err := os.ReadFile(filepath.Join(outputDir, manifestFile))
+	if err != nil {
+		return m
+	}
+	m.Version = 0 // files without a version predate versioning
+	if err := json.Unmarshal(data, m); err != nil {
+		slog.Warn("ignoring unreadable manifest", "output", outputDir, "error", err)
+		return newManifest()
+	}
+	if m.Pages == nil {
+		m.Pages = make(map[string]manifestPage)
+	}
+	return m
+}
+
+func (m *manifest) save(outputDir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return output.WriteFile(filepath.Join(outputDir, manifestFile), data)
+}
+
+func (m *manifest) add(node *docNode, assetPaths []string) {
+	edited, _ := parseNotionTime(node.Page.LastEditedTime)
+	m.Pages[node.ID] = manifestPage{
+		Path:           filepath.ToSlash(node.filePath()),
+		Title:          node.Title,
+		LastEditedTime: node.Page.LastEditedTime,
+		Assets:         assetPaths,
+		Unsettled:      time.Now().Before(edited.Add(time.Minute)),
+	}
+}
+
+// Entry of a page whose file from the previous export can be kept: the page
+// wasn't edited since, goes to the same path and its file still exists
+func (m *manifest) upToDate(outputDir string, node *docNode) (manifestPage, bool) {
+	entry, ok := m.Pages[node.ID]
+	if !ok || m.Version < manifestVersion || entry.Unsettled || entry.LastEditedTime != node.Page.LastEditedTime || entry.Path != filepath.ToSlash(node.filePath()) {
+		return entry, false
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(entry.Path))); err != nil {
+		return entry, false
+	}
+	return entry, true
+}
+
+// Whether any page of the root was added, moved or removed since the
+// previous export. Links to those pages from other pages would be stale.
+func (m *manifest) layoutChanged(r *exportRoot) bool {
+	seen := 0
+	for id, node := range discovered {
+		if node.Page == nil || node.exportRoot() != r {
+			continue
+		}
+		entry, ok := m.Pages[id]
+		if !ok || entry.Path != filepath.ToSlash(node.filePath()) {
+			return true
+		}
+		seen++
+	}
+	return seen != len(m.Pages)
+}
+
+// File or directory name a page was exported under, empty if unknown
+func (m *manifest) nameOf(id string) string {
+	entry, ok := m.Pages[id]
+	if !ok {
+		return ""
+	}
+	if path.Base(entry.Path) == "index.md" {
+		return path.Base(path.Dir(entry.Path))
+	}
+	return strings.TrimSuffix(path.Base(entry.Path), ".md")
+}
+
+// Remove the files of pages that were written somewhere else this time,
+// so a page renamed in Notion moves instead of being duplicated, and of pages
+// no longer exported. Directories left empty are removed too.
+func removeStalePages(outputDir string, previous *manifest, current *manifest) {
+	inUse := make(map[string]bool)
+	for _, entry := range current.Pages {
+		inUse[entry.Path] = true
+		inUse[path.Dir(entry.Path)] = true
+	}
+
+	for id, old := range previous.Pages {
+		entry, ok := current.Pages[id]
+		if ok && entry.Path == old.Path || inUse[old.Path] {
+			continue
+		}
+
+		if err := output.Remove(filepath.Join(outputDir, filepath.FromSlash(old.Path))); err != nil && !os.IsNotExist(err) {
+			slog.Error("failed to remove stale page", "path", old.Path, "error", err)
+			continue
+		}
+		if ok {
+			slog.Info("moved page", "page_id", id, "from", old.Path, "to", entry.Path)
+		} else {
+			slog.Info("removed page", "page_id", id, "path", old.Path)
+		}
+
+		dir := path.Dir(old.Path)
+		if path.Base(old.Path) == "index.md" && !inUse[dir] {
+			output.Remove(filepath.Join(outputDir, filepath.FromSlash(dir), "_category_.json"))
+		}
+		removeEmptyDirs(outputDir, dir)
+	}
+}
+
+// Remove dir and its parents, up to but excluding outputDir, while empty
+func removeEmptyDirs(outputDir string, dir string) {
+	for dir != "." && dir != "/" && dir != "" {
+		full := filepath.Join(outputDir, filepath.FromSlash(dir))
+		if entries, err := os.ReadDir(full); err != nil || len(entries) > 0 {
+			return
+		}
+		if err := output.Remove(full); err != nil {
+			return
+		}
+		dir = path.Dir(dir)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Longest file or directory name generated from a slug or title
+const maxNameLength = 80
+
+// Letters that don't decompose into an ASCII base letter plus accents
+var transliterations = strings.NewReplacer(
+	"ß", "ss", "æ", "ae", "Æ", "ae", "œ", "oe", "Œ", "oe",
+	"ø", "o", "Ø", "o", "ł", "l", "Ł", "l", "đ", "d", "Đ", "d",
+	"þ", "th", "Þ", "th", "ð", "d", "Ð", "d", "ı", "i",
+	"&", " and ",
+)
+
+// Turn a slug or title into a file name: transliterated to ASCII, lower
+// case, with runs of anything other than letters and digits replaced by a
+// single dash. Returns an empty string if nothing usable is left.
+func sanitizeName(s string) string {
+	s = transliterations.Replace(s)
+
+	// Split accented letters into base letter and combining marks, then
+	// drop the marks
+	strip := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	if stripped, _, err := transform.String(strip, s); err == nil {
+		s = stripped
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	name := strings.TrimSuffix(b.String(), "-")
+	if len(name) > maxNameLength {
+		name = strings.TrimSuffix(name[:maxNameLength], "-")
+	}
+	return name
+}
+
+// Name for a node's file or directory, from the last segment of its slug,
+// then its title, then its ID
+func nodeName(slug string, title string, id string) string {
+	slug = strings.Trim(slug, "/")
+	if i := strings.LastIndex(slug, "/"); i >= 0 {
+		slug = slug[i+1:]
+	}
+	for _, candidate := range []string{slug, title} {
+		if name := sanitizeName(candidate); name != "" {
+			return name
+		}
+	}
+	return id
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Getting Started: Intro", "getting-started-intro"},
+		{"Café Über", "cafe-uber"},
+		{"Straße & Co", "strasse-and-co"},
+		{"Ærø", "aero"},
+		{"Version 2.0", "version-2-0"},
+		{"  --Hello--  ", "hello"},
+		{"/docs/intro/", "docs-intro"},
+		{"日本語", ""},
+		{"", ""},
+		{strings.Repeat("a", 100), strings.Repeat("a", maxNameLength)},
+		{strings.Repeat("a", maxNameLength-1) + " bcd", strings.Repeat("a", maxNameLength-1)},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeName(tt.in); got != tt.want {
+			t.Errorf("sanitizeName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNodeName(t *testing.T) {
+	tests := []struct {
+		slug, title, id, want string
+	}{
+		{"/guides/setup/", "Setting things up", "id", "setup"},
+		{"", "Setting things up", "id", "setting-things-up"},
+		{"/日本/", "Intro", "id", "intro"},
+		{"", "日本語", "0123", "0123"},
+	}
+
+	for _, tt := range tests {
+		if got := nodeName(tt.slug, tt.title, tt.id); got != tt.want {
+			t.Errorf("nodeName(%q, %q, %q) = %q, want %q", tt.slug, tt.title, tt.id, got, tt.want)
+		}
+	}
+}
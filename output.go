@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Destination of the files an export generates. Assets are downloaded
+// directly into the directory returned by AssetsDir.
+type outputWriter interface {
+	WriteFile(path string, data []byte) error
+	MkdirAll(path string) error
+	Remove(path string) error
+	AssetsDir(dir string) string
+}
+
+// Writer used by the export, replaced for dry runs and diffs
+var output outputWriter = diskWriter{}
+
+// Writes straight to disk
+type diskWriter struct{}
+
+func (diskWriter) WriteFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0644)
+}
+
+func (diskWriter) MkdirAll(path string) error {
+	return os.MkdirAll(path, os.ModePerm)
+}
+
+func (diskWriter) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (diskWriter) AssetsDir(dir string) string {
+	return dir
+}
+
+// A file created, modified or deleted by the export
+type fileChange struct {
+	Path     string
+	Kind     string // created, modified or deleted
+	Old, New []byte
+	Asset    bool // downloaded asset, contents aren't kept
+}
+
+// Records the changes made by an export. On dry runs nothing is written:
+// pages are kept in memory and assets are downloaded to a temporary
+// directory, so they can be compared with the existing output.
+type recordingWriter struct {
+	dryRun  bool
+	changes map[string]*fileChange
+	staging map[string]string // temporary assets directory by real one
+}
+
+func newRecordingWriter(dryRun bool) *recordingWriter {
+	return &recordingWriter{
+		dryRun:  dryRun,
+		changes: make(map[string]*fileChange),
+		staging: make(map[string]string),
+	}
+}
+
+// Current contents of a file, including changes not written on dry runs
+func (w *recordingWriter) current(path string) ([]byte, bool) {
+	if c, ok := w.changes[path]; ok && w.dryRun {
+		return c.New, c.Kind != "deleted"
+	}
+	data, err := os.ReadFile(path)
+	return data, err == nil
+}
+
+func (w *recordingWriter) record(path string, kind string, old []byte, new []byte) {
+	c, ok := w.changes[path]
+	if !ok {
+		w.changes[path] = &fileChange{Path: path, Kind: kind, Old: old, New: new}
+		return
+	}
+
+	// Compare against the file as it was before the export
+	c.New = new
+	switch {
+	case c.Kind == "created" && kind == "deleted":
+		delete(w.changes, path)
+	case c.Kind == "deleted" && kind != "deleted":
+		c.Kind = "modified"
+	case c.Kind != "created":
+		c.Kind = kind
+	}
+	if c.Kind == "modified" && bytes.Equal(c.Old, c.New) {
+		delete(w.changes, path)
+	}
+}
+
+func (w *recordingWriter) WriteFile(path string, data []byte) error {
+	old, exists := w.current(path)
+	if exists && bytes.Equal(old, data) {
+		return nil
+	}
+	if !w.dryRun {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+	if exists {
+		w.record(path, "modified", old, data)
+	} else {
+		w.record(path, "created", nil, data)
+	}
+	return nil
+}
+
+func (w *recordingWriter) MkdirAll(path string) error {
+	if w.dryRun {
+		return nil
+	}
+	return os.MkdirAll(path, os.ModePerm)
+}
+
+func (w *recordingWriter) Remove(path string) error {
+	// Directories are only removed once empty, which they never get on dry runs
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		if w.dryRun {
+			return nil
+		}
+		return os.Remove(path)
+	}
+
+	old, exists := w.current(path)
+	if !exists {
+		return &fs.PathError{Op: "remove", Path: path, Err: fs.ErrNotExist}
+	}
+	if !w.dryRun {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	w.record(path, "deleted", old, nil)
+	return nil
+}
+
+func (w *recordingWriter) AssetsDir(dir string) string {
+	if !w.dryRun {
+		return dir
+	}
+	if staging, ok := w.staging[dir]; ok {
+		return staging
+	}
+	staging, err := os.MkdirTemp("", "nosaurus-assets-")
+	if err != nil {
+		fatal("failed to create temporary assets directory", "error", err)
+	}
+	w.staging[dir] = staging
+	return staging
+}
+
+// Record the assets downloaded during a dry run that aren't in the real
+// assets directory yet, and remove the temporary directories
+func (w *recordingWriter) finish() {
+	for dir, staging := range w.staging {
+		filepath.WalkDir(staging, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			rel, _ := filepath.Rel(staging, p)
+			dest := filepath.Join(dir, rel)
+			if _, err := os.Stat(dest); os.IsNotExist(err) {
+				w.changes[dest] = &fileChange{Path: dest, Kind: "created", Asset: true}
+			}
+			return nil
+		})
+		os.RemoveAll(staging)
+	}
+}
+
+// Print the changes, with a unified diff of each text file when diffs is set
+func (w *recordingWriter) report(out io.Writer, diffs bool) {
+	paths := make([]string, 0, len(w.changes))
+	counts := make(map[string]int)
+	for path, c := range w.changes {
+		paths = append(paths, path)
+		counts[c.Kind]++
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		c := w.changes[path]
+		fmt.Fprintf(out, "%-8s %s\n", c.Kind, path)
+	}
+	if diffs {
+		for _, path := range paths {
+			c := w.changes[path]
+			if c.Asset {
+				continue
+			}
+			if isBinary(c.Old) || isBinary(c.New) {
+				fmt.Fprintf(out, "Binary file %s %s\n", path, c.Kind)
+				continue
+			}
+			oldName, newName := path, path
+			if c.Kind == "created" {
+				oldName = "/dev/null"
+			}
+			if c.Kind == "deleted" {
+				newName = "/dev/null"
+			}
+			diff, ok := unifiedDiff(oldName, newName, string(c.Old), string(c.New))
+			if !ok {
+				fmt.Fprintf(out, "File %s %s, too large to diff\n", path, c.Kind)
+				continue
+			}
+			fmt.Fprint(out, diff)
+		}
+	}
+
+	verb := "changed"
+	if w.dryRun {
+		verb = "would change"
+	}
+	fmt.Fprintf(out, "%d file(s) %s: %d created, %d modified, %d deleted\n",
+		len(paths), verb, counts["created"], counts["modified"], counts["deleted"])
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Kinds of problems that fail the export in strict mode
+const (
+	problemUnsupportedBlock = "unsupported_block"
+	problemUnresolvedLink   = "unresolved_link"
+	problemAssetFailed      = "asset_failed"
+)
+
+// Content that was rendered incompletely
+type problem struct {
+	Kind    string `json:"kind"`
+	PageID  string `json:"page_id,omitempty"`
+	Title   string `json:"title,omitempty"`
+	BlockID string `json:"block_id,omitempty"`
+	Detail  string `json:"detail"`
+}
+
+// Page and block being rendered, recorded with the problems found
+var rendering struct {
+	page    *docNode
+	blockID string
+
+	// First part of the page's content that couldn't be fetched, the page
+	// fails to export rather than being written incomplete
+	err error
+}
+
+// Record content of the page being rendered that couldn't be fetched
+func failRendering(err error) {
+	if rendering.err == nil {
+		rendering.err = err
+	}
+}
+
+// Record a problem with the page and block being rendered. It is logged as
+// an error in strict mode and as a warning otherwise.
+func reportProblem(kind string, detail string, args ...any) {
+	p := problem{Kind: kind, BlockID: rendering.blockID, Detail: detail}
+	if rendering.page != nil {
+		p.PageID, p.Title = rendering.page.ID, rendering.page.Title
+	}
+	stats.Problems = append(stats.Problems, p)
+
+	level := slog.LevelWarn
+	if conf.Strict {
+		level = slog.LevelError
+	}
+	if p.BlockID != "" {
+		args = append([]any{"block_id", p.BlockID}, args...)
+	}
+	pageLog.Log(context.Background(), level, detail, append([]any{"problem", kind}, args...)...)
+}
+
+// List the problems found, one per line
+func printProblems(out io.Writer) {
+	for _, p := range stats.Problems {
+		fmt.Fprintf(out, "%s: %s, page %s (%s)", p.Kind, p.Detail, p.PageID, p.Title)
+		if p.BlockID != "" {
+			fmt.Fprintf(out, ", block %s", p.BlockID)
+		}
+		fmt.Fprintln(out)
+	}
+}
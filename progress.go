@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress display modes of -progress
+const (
+	progressAuto  = "auto"  // bar on a terminal, log lines otherwise
+	progressBar   = "bar"   // redrawn bar on stderr
+	progressLines = "lines" // periodic log entries
+	progressOff   = "off"
+)
+
+// Time between progress log entries, and between redraws of the bar
+const (
+	progressLineInterval = 10 * time.Second
+	progressBarInterval  = 200 * time.Millisecond
+)
+
+// Width of the bar, in characters
+const progressBarWidth = 24
+
+// Events reported by the export to the progress display
+type progressEvent int
+
+const (
+	eventPageDiscovered progressEvent = iota
+	eventRenderStarted
+	eventPageRendered
+	eventAssetDownloaded
+)
+
+// Progress of the running export, nil when it isn't displayed
+var progress *progressReporter
+
+type progressReporter struct {
+	mu   sync.Mutex
+	bar  bool
+	out  io.Writer
+	stop chan struct{}
+	done chan struct{}
+
+	discovered, rendered, total, assets int
+
+	// Render phase start, zero while pages are being discovered
+	renderStart time.Time
+
+	// End of the current rate limit wait
+	rateLimitedUntil time.Time
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Parse a -progress mode
+func parseProgressMode(mode string) (string, error) {
+	switch mode {
+	case progressAuto, progressBar, progressLines, progressOff:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown mode %q, use auto, bar, lines or off", mode)
+}
+
+// Start displaying the progress of an export, the returned function stops it.
+// In auto mode the bar is drawn when stderr is a terminal showing text logs,
+// and log entries are written otherwise. Entries are info messages, so quiet
+// runs don't get them.
+func startProgress(mode string) func() {
+	logged := slog.Default().Enabled(context.Background(), slog.LevelInfo)
+	if mode == progressAuto {
+		switch {
+		case !logged:
+			mode = progressOff
+		case isTerminal(os.Stderr) && !logOptions.json:
+			mode = progressBar
+		default:
+			mode = progressLines
+		}
+	}
+	if mode == progressOff {
+		return func() {}
+	}
+
+	p := &progressReporter{
+		bar:  mode == progressBar,
+		out:  os.Stderr,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	interval := progressLineInterval
+	if p.bar {
+		interval = progressBarInterval
+		// Log entries clear the bar and are followed by a redraw
+		logTo(p)
+	}
+	progress = p
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.mu.Lock()
+				p.report()
+				p.mu.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(p.stop)
+		<-p.done
+		progress = nil
+		if p.bar {
+			fmt.Fprint(p.out, "\r\033[K")
+			logTo(os.Stderr)
+		}
+	}
+}
+
+// Report an event of the export to the progress display
+func emit(event progressEvent) {
+	if progress == nil {
+		return
+	}
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	switch event {
+	case eventPageDiscovered:
+		progress.discovered++
+	case eventRenderStarted:
+		if progress.renderStart.IsZero() {
+			progress.renderStart = time.Now()
+			progress.total = progress.discovered
+		}
+	case eventPageRendered:
+		progress.rendered++
+	case eventAssetDownloaded:
+		progress.assets++
+	}
+	// Requests go through again
+	progress.rateLimitedUntil = time.Time{}
+}
+
+// Report a rate limited API request, retried after wait
+func emitRateLimited(wait time.Duration) {
+	if progress == nil {
+		return
+	}
+	progress.mu.Lock()
+	progress.rateLimitedUntil = time.Now().Add(wait)
+	progress.mu.Unlock()
+}
+
+// Estimated time left to render the remaining pages, from the rate so far.
+// Zero until it can be estimated.
+func (p *progressReporter) eta() time.Duration {
+	if p.renderStart.IsZero() || p.rendered == 0 || p.rendered >= p.total {
+		return 0
+	}
+	perPage := time.Since(p.renderStart) / time.Duration(p.rendered)
+	return perPage * time.Duration(p.total-p.rendered)
+}
+
+func (p *progressReporter) rateLimited() bool {
+	return time.Now().Before(p.rateLimitedUntil)
+}
+
+// Draw the bar or log an entry, with p.mu held
+func (p *progressReporter) report() {
+	if !p.bar {
+		args := []any{"pages_discovered", p.discovered, "assets_downloaded", p.assets}
+		if !p.renderStart.IsZero() {
+			args = append(args, "pages_rendered", p.rendered, "pages_total", p.total)
+			if eta := p.eta(); eta > 0 {
+				args = append(args, "eta", eta.Round(time.Second))
+			}
+		}
+		if p.rateLimited() {
+			args = append(args, "rate_limited", true)
+		}
+		slog.Info("progress", args...)
+		return
+	}
+
+	var line string
+	if p.renderStart.IsZero() {
+		line = fmt.Sprintf("Discovering pages: %d found, %d asset(s)", p.discovered, p.assets)
+	} else {
+		filled := progressBarWidth
+		if p.total > 0 && p.rendered < p.total {
+			filled = progressBarWidth * p.rendered / p.total
+		}
+		line = fmt.Sprintf("[%s%s] %d/%d pages, %d asset(s)",
+			strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled),
+			p.rendered, p.total, p.assets)
+		if eta := p.eta(); eta > 0 {
+			line += ", ETA " + eta.Round(time.Second).String()
+		}
+	}
+	if p.rateLimited() {
+		line += ", rate limited"
+	}
+	fmt.Fprint(p.out, "\r\033[K"+line)
+}
+
+// Write a log entry above the bar
+func (p *progressReporter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.out, "\r\033[K")
+	n, err := p.out.Write(b)
+	p.report()
+	return n, err
+}
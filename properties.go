@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Roles a database property can be mapped to. Any other role name is
+// written to the frontmatter as a field of that name.
+const (
+	roleTitle        = "title"
+	roleSlug         = "slug"
+	roleKeywords     = "keywords"
+	roleParent       = "parent"
+	roleChildren     = "children"
+	roleDescription  = "description"
+	roleTags         = "tags"
+	roleImage        = "image"
+	roleHideTOC      = "hide_table_of_contents"
+	roleDraft        = "draft"
+	roleLastUpdate   = "last_update"
+	roleEditURL      = "custom_edit_url"
+	roleCollapsed    = "collapsed"
+	roleCollapsible  = "collapsible"
+	roleClassName    = "class_name"
+	roleCategoryLink = "category_link"
+	rolePosition     = "position"
+)
+
+var builtinRoles = map[string]bool{
+	roleTitle:        true,
+	roleSlug:         true,
+	roleKeywords:     true,
+	roleParent:       true,
+	roleChildren:     true,
+	roleDescription:  true,
+	roleTags:         true,
+	roleImage:        true,
+	roleHideTOC:      true,
+	roleDraft:        true,
+	roleLastUpdate:   true,
+	roleEditURL:      true,
+	roleCollapsed:    true,
+	roleCollapsible:  true,
+	roleClassName:    true,
+	roleCategoryLink: true,
+	rolePosition:     true,
+}
+
+// Property names used for each role unless the property map says otherwise
+var defaultPropertyMap = map[string]string{
+	"Name":        roleTitle,
+	"Slug":        roleSlug,
+	"Keywords":    roleKeywords,
+	"Parent":      roleParent,
+	"Sub-Items":   roleChildren,
+	"Description": roleDescription,
+	"Tags":        roleTags,
+	"Image":       roleImage,
+	"Draft":       roleDraft,
+	"Order":       rolePosition,
+}
+
+// Parse a property mapping given as comma separated Property=role pairs
+func parsePropertyMap(spec string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, role, ok := strings.Cut(pair, "=")
+		name, role = strings.TrimSpace(name), strings.TrimSpace(role)
+		if !ok || name == "" || role == "" {
+			return nil, fmt.Errorf("expected Property=role, got %q", pair)
+		}
+		mapping[name] = role
+	}
+	return mapping, nil
+}
+
+// Names of the properties mapped to role, explicit mappings first. Default
+// names are skipped when the property map assigns them another role.
+func propertyNames(role string) []string {
+	var names, defaults []string
+	for name, r := range conf.PropertyMap {
+		if r == role {
+			names = append(names, name)
+		}
+	}
+	for name, r := range defaultPropertyMap {
+		if _, mapped := conf.PropertyMap[name]; r == role && !mapped {
+			defaults = append(defaults, name)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(defaults)
+	return append(names, defaults...)
+}
+
+// Find the property mapped to role on a page. A page without a mapped title
+// property uses its title-type property, whatever it is named. Default title
+// names only match title-type properties, so a "Name" text column doesn't
+// hide the real title.
+func findProperty(page NotionPage, role string) (Property, bool) {
+	for _, name := range propertyNames(role) {
+		prop, ok := page.Properties[name]
+		if !ok || role == roleTitle && prop.Type != "title" && conf.PropertyMap[name] != role {
+			continue
+		}
+		return prop, true
+	}
+
+	if role == roleTitle {
+		for _, prop := range page.Properties {
+			if prop.Type == "title" {
+				return prop, true
+			}
+		}
+	}
+
+	return Property{}, false
+}
+
+// Helper function to extract property values from a page
+func extractPageProperties(page NotionPage) (title string, slug string, keywords string) {
+	// Title
+	if titleProp, ok := findProperty(page, roleTitle); ok {
+		title = titleProp.Text()
+	}
+
+	// Slug
+	if slugProp, ok := findProperty(page, roleSlug); ok {
+		slug = slugProp.Text()
+		if slug == "" {
+			slug = title
+		}
+		slug = strings.ReplaceAll(slug, " ", "-")
+		slug = strings.ReplaceAll(slug, "(", "")
+		slug = strings.ReplaceAll(slug, ")", "")
+	}
+
+	// Keywords
+	if keywordsProp, ok := findProperty(page, roleKeywords); ok {
+		keywords = keywordsProp.Text()
+	}
+
+	return title, slug, keywords
+}
+
+func extractPageRelations(page NotionPage) (parentId string, childPages []string) {
+	if parent, ok := findProperty(page, roleParent); ok {
+		if ids := parent.RelationIDs(); len(ids) > 0 {
+			parentId = ids[0]
+		}
+	}
+	if subItems, ok := findProperty(page, roleChildren); ok {
+		childPages = subItems.RelationIDs()
+	}
+
+	return parentId, childPages
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Represents the value of a page property. Only the field matching Type is
+// set, use the accessor methods rather than reading the fields directly.
+type Property struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+
+	Title          []RichText     `json:"title,omitempty"`
+	RichText       []RichText     `json:"rich_text,omitempty"`
+	Number         *float64       `json:"number,omitempty"`
+	Select         *SelectOption  `json:"select,omitempty"`
+	MultiSelect    []SelectOption `json:"multi_select,omitempty"`
+	Status         *SelectOption  `json:"status,omitempty"`
+	Date           *DateValue     `json:"date,omitempty"`
+	People         []User         `json:"people,omitempty"`
+	Checkbox       bool           `json:"checkbox,omitempty"`
+	URL            *string        `json:"url,omitempty"`
+	Email          *string        `json:"email,omitempty"`
+	PhoneNumber    *string        `json:"phone_number,omitempty"`
+	Formula        *FormulaValue  `json:"formula,omitempty"`
+	Rollup         *RollupValue   `json:"rollup,omitempty"`
+	Relation       []Relation     `json:"relation,omitempty"`
+	Files          []FileBlock    `json:"files,omitempty"`
+	CreatedTime    string         `json:"created_time,omitempty"`
+	LastEditedTime string         `json:"last_edited_time,omitempty"`
+	CreatedBy      *User          `json:"created_by,omitempty"`
+	LastEditedBy   *User          `json:"last_edited_by,omitempty"`
+	UniqueID       *UniqueID      `json:"unique_id,omitempty"`
+}
+
+// Represents an option of a select, multi_select or status property
+type SelectOption struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// Represents the value of a date property
+type DateValue struct {
+	Start    string  `json:"start"`
+	End      *string `json:"end"`
+	TimeZone *string `json:"time_zone"`
+}
+
+// Represents the result of a formula property
+type FormulaValue struct {
+	Type    string     `json:"type"`
+	String  *string    `json:"string,omitempty"`
+	Number  *float64   `json:"number,omitempty"`
+	Boolean *bool      `json:"boolean,omitempty"`
+	Date    *DateValue `json:"date,omitempty"`
+}
+
+// Represents the result of a rollup property, array items are property values
+type RollupValue struct {
+	Type     string     `json:"type"`
+	Function string     `json:"function"`
+	Number   *float64   `json:"number,omitempty"`
+	Date     *DateValue `json:"date,omitempty"`
+	Array    []Property `json:"array,omitempty"`
+}
+
+// Represents a page referenced by a relation property
+type Relation struct {
+	ID string `json:"id"`
+}
+
+// Represents the value of a unique_id property, e.g. DOC-42
+type UniqueID struct {
+	Prefix *string `json:"prefix"`
+	Number int     `json:"number"`
+}
+
+// Plain text form of the property value, empty when it has no value
+func (p Property) Text() string {
+	switch p.Type {
+	case "title":
+		return richTextPlain(p.Title)
+	case "rich_text":
+		return richTextPlain(p.RichText)
+	case "number":
+		return formatNumber(p.Number)
+	case "select", "multi_select", "status":
+		return strings.Join(p.Options(), ", ")
+	case "date":
+		return p.Date.text()
+	case "people":
+		var names []string
+		for _, user := range p.People {
+			names = append(names, user.Name)
+		}
+		return strings.Join(names, ", ")
+	case "checkbox":
+		return strconv.FormatBool(p.Checkbox)
+	case "url":
+		return stringValue(p.URL)
+	case "email":
+		return stringValue(p.Email)
+	case "phone_number":
+		return stringValue(p.PhoneNumber)
+	case "formula":
+		return p.Formula.text()
+	case "rollup":
+		return p.Rollup.text()
+	case "relation":
+		return strings.Join(p.RelationIDs(), ", ")
+	case "files":
+		return strings.Join(p.FileURLs(), ", ")
+	case "created_time":
+		return p.CreatedTime
+	case "last_edited_time":
+		return p.LastEditedTime
+	case "created_by":
+		return userName(p.CreatedBy)
+	case "last_edited_by":
+		return userName(p.LastEditedBy)
+	case "unique_id":
+		return p.UniqueID.text()
+	}
+	return ""
+}
+
+// Option names of a select, multi_select or status property
+func (p Property) Options() []string {
+	var names []string
+	switch p.Type {
+	case "select":
+		if p.Select != nil {
+			names = append(names, p.Select.Name)
+		}
+	case "status":
+		if p.Status != nil {
+			names = append(names, p.Status.Name)
+		}
+	case "multi_select":
+		for _, option := range p.MultiSelect {
+			names = append(names, option.Name)
+		}
+	}
+	return names
+}
+
+// Values of the property as a list: option names for selects, and the
+// comma separated parts of the text for anything else
+func (p Property) List() []string {
+	switch p.Type {
+	case "select", "multi_select", "status":
+		return p.Options()
+	}
+	var items []string
+	for _, item := range strings.Split(p.Text(), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// IDs of the pages a relation property points to
+func (p Property) RelationIDs() []string {
+	var ids []string
+	for _, relation := range p.Relation {
+		if relation.ID != "" {
+			ids = append(ids, relation.ID)
+		}
+	}
+	return ids
+}
+
+// URLs of the files in a files property
+func (p Property) FileURLs() []string {
+	var urls []string
+	for _, file := range p.Files {
+		if file.File != nil {
+			urls = append(urls, file.File.URL)
+		} else if file.External != nil {
+			urls = append(urls, file.External.URL)
+		}
+	}
+	return urls
+}
+
+// Numeric value of number properties, and of formulas and rollups that
+// evaluate to a number
+func (p Property) Float() (float64, bool) {
+	var n *float64
+	switch p.Type {
+	case "number":
+		n = p.Number
+	case "formula":
+		if p.Formula != nil {
+			n = p.Formula.Number
+		}
+	case "rollup":
+		if p.Rollup != nil {
+			n = p.Rollup.Number
+		}
+	case "unique_id":
+		if p.UniqueID != nil {
+			f := float64(p.UniqueID.Number)
+			n = &f
+		}
+	}
+	if n == nil {
+		return 0, false
+	}
+	return *n, true
+}
+
+// Boolean value of checkbox properties and boolean formulas. Text values
+// such as "true" or "yes" are accepted too.
+func (p Property) Bool() (bool, bool) {
+	switch p.Type {
+	case "checkbox":
+		return p.Checkbox, true
+	case "formula":
+		if p.Formula != nil && p.Formula.Boolean != nil {
+			return *p.Formula.Boolean, true
+		}
+		return false, false
+	}
+	switch strings.ToLower(strings.TrimSpace(p.Text())) {
+	case "true", "yes", "1":
+		return true, true
+	case "false", "no", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// Time value of date properties, created/last edited times, and formulas and
+// rollups that evaluate to a date. Date ranges return their start.
+func (p Property) Time() (time.Time, bool) {
+	var raw string
+	switch p.Type {
+	case "date":
+		if p.Date != nil {
+			raw = p.Date.Start
+		}
+	case "created_time":
+		raw = p.CreatedTime
+	case "last_edited_time":
+		raw = p.LastEditedTime
+	case "formula":
+		if p.Formula != nil && p.Formula.Date != nil {
+			raw = p.Formula.Date.Start
+		}
+	case "rollup":
+		if p.Rollup != nil && p.Rollup.Date != nil {
+			raw = p.Rollup.Date.Start
+		}
+	}
+	return parseNotionTime(raw)
+}
+
+// Parse a Notion timestamp, which is either a full ISO 8601 time or a date
+func parseNotionTime(raw string) (time.Time, bool) {
+	if raw == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (d *DateValue) text() string {
+	if d == nil {
+		return ""
+	}
+	if d.End != nil && *d.End != "" {
+		return d.Start + " - " + *d.End
+	}
+	return d.Start
+}
+
+func (f *FormulaValue) text() string {
+	if f == nil {
+		return ""
+	}
+	switch f.Type {
+	case "string":
+		return stringValue(f.String)
+	case "number":
+		return formatNumber(f.Number)
+	case "boolean":
+		if f.Boolean != nil {
+			return strconv.FormatBool(*f.Boolean)
+		}
+	case "date":
+		return f.Date.text()
+	}
+	return ""
+}
+
+func (r *RollupValue) text() string {
+	if r == nil {
+		return ""
+	}
+	switch r.Type {
+	case "number":
+		return formatNumber(r.Number)
+	case "date":
+		return r.Date.text()
+	case "array":
+		var items []string
+		for _, item := range r.Array {
+			if text := item.Text(); text != "" {
+				items = append(items, text)
+			}
+		}
+		return strings.Join(items, ", ")
+	}
+	return ""
+}
+
+func (u *UniqueID) text() string {
+	if u == nil {
+		return ""
+	}
+	if u.Prefix != nil && *u.Prefix != "" {
+		return *u.Prefix + "-" + strconv.Itoa(u.Number)
+	}
+	return strconv.Itoa(u.Number)
+}
+
+func richTextPlain(rich []RichText) string {
+	var text string
+	for _, t := range rich {
+		text += t.PlainText
+	}
+	return text
+}
+
+func formatNumber(n *float64) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*n, 'f', -1, 64)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func userName(u *User) string {
+	if u == nil {
+		return ""
+	}
+	return u.Name
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Page as returned by the API, with a property of every type
+const propertiesPageJSON = `{
+  "object": "page",
+  "id": "0123456789abcdef0123456789abcdef",
+  "properties": {
+    "Name": {"id": "title", "type": "title", "title": [
+      {"type": "text", "text": {"content": "Getting "}, "plain_text": "Getting "},
+      {"type": "text", "text": {"content": "Started"}, "annotations": {"bold": true}, "plain_text": "Started"}
+    ]},
+    "Summary": {"id": "a", "type": "rich_text", "rich_text": [{"type": "text", "plain_text": "Short, sweet"}]},
+    "Reviewed": {"id": "b", "type": "rich_text", "rich_text": [{"type": "text", "plain_text": " Yes "}]},
+    "Order": {"id": "c", "type": "number", "number": 2.5},
+    "Category": {"id": "d", "type": "select", "select": {"id": "s1", "name": "Guides", "color": "blue"}},
+    "Tags": {"id": "e", "type": "multi_select", "multi_select": [{"id": "m1", "name": "go"}, {"id": "m2", "name": "docs"}]},
+    "Status": {"id": "f", "type": "status", "status": {"id": "st", "name": "Published", "color": "green"}},
+    "Published": {"id": "g", "type": "date", "date": {"start": "2024-03-01", "end": "2024-03-05", "time_zone": null}},
+    "Owners": {"id": "h", "type": "people", "people": [{"object": "user", "id": "u1", "name": "Ada"}, {"object": "user", "id": "u2", "name": "Lin"}]},
+    "Draft": {"id": "i", "type": "checkbox", "checkbox": true},
+    "Website": {"id": "j", "type": "url", "url": "https://example.com"},
+    "No website": {"id": "k", "type": "url", "url": null},
+    "Contact": {"id": "l", "type": "email", "email": "docs@example.com"},
+    "Phone": {"id": "m", "type": "phone_number", "phone_number": "+1 555 0100"},
+    "Version": {"id": "n", "type": "formula", "formula": {"type": "string", "string": "v2"}},
+    "Score": {"id": "o", "type": "formula", "formula": {"type": "number", "number": 3}},
+    "Public": {"id": "p", "type": "formula", "formula": {"type": "boolean", "boolean": false}},
+    "Due": {"id": "q", "type": "formula", "formula": {"type": "date", "date": {"start": "2024-02-01T09:00:00.000Z", "end": null}}},
+    "Total": {"id": "r", "type": "rollup", "rollup": {"type": "number", "number": 7, "function": "sum"}},
+    "Latest": {"id": "s", "type": "rollup", "rollup": {"type": "date", "date": {"start": "2024-04-01", "end": null}, "function": "latest_date"}},
+    "Names": {"id": "t", "type": "rollup", "rollup": {"type": "array", "function": "show_original", "array": [
+      {"type": "rich_text", "rich_text": [{"type": "text", "plain_text": "a"}]},
+      {"type": "number", "number": 1}
+    ]}},
+    "Parent": {"id": "u", "type": "relation", "relation": [{"id": "p1"}], "has_more": false},
+    "Attachments": {"id": "v", "type": "files", "files": [
+      {"name": "a.pdf", "type": "file", "file": {"url": "https://files.example.com/a.pdf", "expiry_time": "2024-01-01T00:00:00.000Z"}},
+      {"name": "b", "type": "external", "external": {"url": "https://example.com/b"}}
+    ]},
+    "Created": {"id": "w", "type": "created_time", "created_time": "2024-01-15T10:30:00.000Z"},
+    "Edited": {"id": "x", "type": "last_edited_time", "last_edited_time": "2024-01-16T08:00:00.000Z"},
+    "Author": {"id": "y", "type": "created_by", "created_by": {"object": "user", "id": "u1", "name": "Ada"}},
+    "Editor": {"id": "z", "type": "last_edited_by", "last_edited_by": {"object": "user", "id": "u2"}},
+    "ID": {"id": "0", "type": "unique_id", "unique_id": {"prefix": "DOC", "number": 42}}
+  }
+}`
+
+func TestPropertyValues(t *testing.T) {
+	var page NotionPage
+	if err := json.Unmarshal([]byte(propertiesPageJSON), &page); err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(y int, m time.Month, d, h, min int) time.Time { return time.Date(y, m, d, h, min, 0, 0, time.UTC) }
+	tests := []struct {
+		name    string
+		text    string
+		list    []string
+		float   float64
+		isFloat bool
+		boolean bool
+		isBool  bool
+		time    time.Time // zero when there is none
+	}{
+		{name: "Name", text: "Getting Started", list: []string{"Getting Started"}},
+		{name: "Summary", text: "Short, sweet", list: []string{"Short", "sweet"}},
+		{name: "Reviewed", text: " Yes ", list: []string{"Yes"}, boolean: true, isBool: true},
+		{name: "Order", text: "2.5", list: []string{"2.5"}, float: 2.5, isFloat: true},
+		{name: "Category", text: "Guides", list: []string{"Guides"}},
+		{name: "Tags", text: "go, docs", list: []string{"go", "docs"}},
+		{name: "Status", text: "Published", list: []string{"Published"}},
+		{name: "Published", text: "2024-03-01 - 2024-03-05", list: []string{"2024-03-01 - 2024-03-05"}, time: day(2024, 3, 1, 0, 0)},
+		{name: "Owners", text: "Ada, Lin", list: []string{"Ada", "Lin"}},
+		{name: "Draft", text: "true", list: []string{"true"}, boolean: true, isBool: true},
+		{name: "Website", text: "https://example.com", list: []string{"https://example.com"}},
+		{name: "No website"},
+		{name: "Contact", text: "docs@example.com", list: []string{"docs@example.com"}},
+		{name: "Phone", text: "+1 555 0100", list: []string{"+1 555 0100"}},
+		{name: "Version", text: "v2", list: []string{"v2"}},
+		{name: "Score", text: "3", list: []string{"3"}, float: 3, isFloat: true},
+		{name: "Public", text: "false", list: []string{"false"}, isBool: true},
+		{name: "Due", text: "2024-02-01T09:00:00.000Z", list: []string{"2024-02-01T09:00:00.000Z"}, time: day(2024, 2, 1, 9, 0)},
+		{name: "Total", text: "7", list: []string{"7"}, float: 7, isFloat: true},
+		{name: "Latest", text: "2024-04-01", list: []string{"2024-04-01"}, time: day(2024, 4, 1, 0, 0)},
+		{name: "Names", text: "a, 1", list: []string{"a", "1"}},
+		{name: "Parent", text: "p1", list: []string{"p1"}},
+		{name: "Attachments", text: "https://files.example.com/a.pdf, https://example.com/b", list: []string{"https://files.example.com/a.pdf", "https://example.com/b"}},
+		{name: "Created", text: "2024-01-15T10:30:00.000Z", list: []string{"2024-01-15T10:30:00.000Z"}, time: day(2024, 1, 15, 10, 30)},
+		{name: "Edited", text: "2024-01-16T08:00:00.000Z", list: []string{"2024-01-16T08:00:00.000Z"}, time: day(2024, 1, 16, 8, 0)},
+		{name: "Author", text: "Ada", list: []string{"Ada"}},
+		{name: "Editor"},
+		{name: "ID", text: "DOC-42", list: []string{"DOC-42"}, float: 42, isFloat: true},
+	}
+
+	if len(tests) != len(page.Properties) {
+		t.Errorf("%d properties tested, the page has %d", len(tests), len(page.Properties))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := page.Properties[tt.name]
+			if !ok {
+				t.Fatalf("property %q not found", tt.name)
+			}
+			if got := p.Text(); got != tt.text {
+				t.Errorf("Text() = %q, want %q", got, tt.text)
+			}
+			if got := p.List(); !reflect.DeepEqual(got, tt.list) {
+				t.Errorf("List() = %q, want %q", got, tt.list)
+			}
+			if got, ok := p.Float(); got != tt.float || ok != tt.isFloat {
+				t.Errorf("Float() = %v, %v, want %v, %v", got, ok, tt.float, tt.isFloat)
+			}
+			if got, ok := p.Bool(); ok != tt.isBool || ok && got != tt.boolean {
+				t.Errorf("Bool() = %v, %v, want %v, %v", got, ok, tt.boolean, tt.isBool)
+			}
+			if got, ok := p.Time(); !got.Equal(tt.time) || ok != !tt.time.IsZero() {
+				t.Errorf("Time() = %v, %v, want %v", got, ok, tt.time)
+			}
+		})
+	}
+}
+
+func TestExtractPageProperties(t *testing.T) {
+	tests := []struct {
+		name        string
+		properties  string
+		propertyMap map[string]string
+		title       string
+		slug        string
+	}{
+		{
+			name:       "empty title",
+			properties: `"Name": {"type": "title", "title": []}, "Slug": {"type": "rich_text", "rich_text": []}`,
+		},
+		{
+			name:       "slug from the title",
+			properties: `"Name": {"type": "title", "title": [{"plain_text": "Setup (Linux) Guide"}]}, "Slug": {"type": "rich_text", "rich_text": []}`,
+			title:      "Setup (Linux) Guide",
+			slug:       "Setup-Linux-Guide",
+		},
+		{
+			name:       "formula slug",
+			properties: `"Name": {"type": "title", "title": [{"plain_text": "Setup"}]}, "Slug": {"type": "formula", "formula": {"type": "string", "string": "install"}}`,
+			title:      "Setup",
+			slug:       "install",
+		},
+		{
+			name:       "select slug",
+			properties: `"Name": {"type": "title", "title": [{"plain_text": "Setup"}]}, "Slug": {"type": "select", "select": null}`,
+			title:      "Setup",
+			slug:       "Setup",
+		},
+		{
+			name:       "title property with another name",
+			properties: `"Page": {"type": "title", "title": [{"plain_text": "Setup"}]}`,
+			title:      "Setup",
+		},
+		{
+			name:       "default title name of another type",
+			properties: `"Name": {"type": "rich_text", "rich_text": [{"plain_text": "Ada"}]}, "Page": {"type": "title", "title": [{"plain_text": "Setup"}]}`,
+			title:      "Setup",
+		},
+		{
+			name:        "mapped title of another type",
+			properties:  `"Heading": {"type": "rich_text", "rich_text": [{"plain_text": "Install"}]}, "Page": {"type": "title", "title": [{"plain_text": "Setup"}]}`,
+			propertyMap: map[string]string{"Heading": roleTitle},
+			title:       "Install",
+		},
+	}
+
+	defer func(saved map[string]string) { conf.PropertyMap = saved }(conf.PropertyMap)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.PropertyMap = tt.propertyMap
+			var page NotionPage
+			if err := json.Unmarshal([]byte(`{"object": "page", "properties": {`+tt.properties+`}}`), &page); err != nil {
+				t.Fatal(err)
+			}
+			title, slug, _ := extractPageProperties(page)
+			if title != tt.title || slug != tt.slug {
+				t.Errorf("extractPageProperties() = %q, %q, want %q, %q", title, slug, tt.title, tt.slug)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Exit codes of the commands
+const (
+	exitFailed = 1 // pages failed to export, or a fatal error
+	exitStrict = 3 // more problems than -strict-threshold allows
+)
+
+// Counts of what happened during a run, reported when it finishes
+type runStats struct {
+	PagesWritten      int            `json:"pages_written"`
+	PagesUnchanged    int            `json:"pages_unchanged"`
+	PagesSkipped      int            `json:"pages_skipped"`
+	PagesFailed       int            `json:"pages_failed"`
+	AssetsDownloaded  int            `json:"assets_downloaded"`
+	AssetBytes        int64          `json:"asset_bytes"`
+	AssetsFailed      int            `json:"assets_failed"`
+	AssetRetries      int            `json:"asset_retries"`
+	UnsupportedBlocks map[string]int `json:"unsupported_blocks"`
+	APICalls          int            `json:"api_calls"`
+	APIRetries        int            `json:"api_retries"`
+	Problems          []problem      `json:"problems"`
+}
+
+func newRunStats() runStats {
+	return runStats{UnsupportedBlocks: make(map[string]int)}
+}
+
+var stats = newRunStats()
+
+// Problems counted against -strict-threshold
+func warningCount() int {
+	return len(stats.Problems)
+}
+
+// Print the summary of a run
+func printSummary(out io.Writer) {
+	fmt.Fprintf(out, "Pages: %d written, %d unchanged, %d skipped, %d failed\n",
+		stats.PagesWritten, stats.PagesUnchanged, stats.PagesSkipped, stats.PagesFailed)
+	fmt.Fprintf(out, "Assets: %d downloaded (%s), %d failed, %d retries\n",
+		stats.AssetsDownloaded, humanSize(stats.AssetBytes), stats.AssetsFailed, stats.AssetRetries)
+
+	if len(stats.UnsupportedBlocks) > 0 {
+		types := make([]string, 0, len(stats.UnsupportedBlocks))
+		for t := range stats.UnsupportedBlocks {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		fmt.Fprint(out, "Unsupported blocks:")
+		for _, t := range types {
+			fmt.Fprintf(out, " %s=%d", t, stats.UnsupportedBlocks[t])
+		}
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintf(out, "API: %d calls, %d retries\n", stats.APICalls, stats.APIRetries)
+	if len(stats.Problems) > 0 {
+		fmt.Fprintf(out, "Problems: %d\n", len(stats.Problems))
+	}
+}
+
+// Write the summary as JSON to path, "-" for stdout
+func writeSummaryJSON(path string) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Exit code of a finished run, threshold is the number of warnings allowed,
+// negative for any number
+func exitCode(threshold int) int {
+	switch {
+	case stats.PagesFailed > 0:
+		return exitFailed
+	case threshold >= 0 && warningCount() > threshold:
+		return exitStrict
+	}
+	return 0
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// Kinds of Notion objects an export can start from
+const (
+	objectPage       = "page"
+	objectDatabase   = "database"
+	objectDataSource = "data_source"
+)
+
+// Data sources only exist from this API version on
+const dataSourceVersion = "2025-09-03"
+
+// API URL and version to use for a database or data source
+func collectionEndpoint(kind string, id string) (string, string) {
+	if kind == objectDataSource {
+		return fmt.Sprintf("https://api.notion.com/v1/data_sources/%s", id), dataSourceVersion
+	}
+	return fmt.Sprintf("https://api.notion.com/v1/databases/%s", id), "2022-06-28"
+}
+
+// Parse a Notion ID given either as is, with or without dashes, or as the
+// URL of a page or database, e.g.
+// https://www.notion.so/acme/Getting-Started-0123456789abcdef0123456789abcdef?v=...
+// Pages opened as a peek (?p=...) resolve to the peeked page.
+func parseNotionID(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	candidate := s
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		candidate = u.Query().Get("p")
+		if candidate == "" {
+			candidate = u.Path[strings.LastIndex(u.Path, "/")+1:]
+		}
+	}
+
+	hex := strings.ReplaceAll(candidate, "-", "")
+	if len(hex) > 32 {
+		hex = hex[len(hex)-32:]
+	}
+	if len(hex) != 32 || strings.Trim(strings.ToLower(hex), "0123456789abcdef") != "" {
+		return "", fmt.Errorf("no Notion ID found in %q", s)
+	}
+
+	hex = strings.ToLower(hex)
+	return hex[0:8] + "-" + hex[8:12] + "-" + hex[12:16] + "-" + hex[16:20] + "-" + hex[20:], nil
+}
+
+// Find out whether an ID is a page, a database or a data source
+func detectObjectKind(token string, id string) (string, error) {
+	if page, err := fetchPage(token, id); err == nil && page.Object == objectPage {
+		return objectPage, nil
+	}
+	if _, err := fetchDatabase(token, objectDatabase, id); err == nil {
+		return objectDatabase, nil
+	}
+	_, err := fetchDatabase(token, objectDataSource, id)
+	if err != nil {
+		return "", fmt.Errorf("not a page, database or data source shared with the integration: %v", err)
+	}
+	return objectDataSource, nil
+}
+
+// A page, database or data source exported to its own output directory,
+// published under its own docs route with its own assets
+type exportRoot struct {
+	Spec      string // ID or URL as given
+	ID        string
+	Kind      string
+	OutputDir string
+	DocsRoot  string
+	AssetsDir string
+	Sidebars  string // sidebars file to write, none when empty
+	IDPrefix  string // prefix of doc IDs, the output directory relative to the docs directory
+
+	node *docNode
+
+	// Some pages couldn't be fetched, pages missing from the tree may still
+	// exist in Notion
+	incomplete bool
+}
+
+// Repeatable -root flag, each value is a comma separated list of
+// key=value settings: id, out, docs, assets, sidebars and idprefix
+type rootFlags []string
+
+func (f *rootFlags) String() string { return strings.Join(*f, " ") }
+
+func (f *rootFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// Parse a -root value, settings it leaves out are taken from defaults except
+// for the output directory and the ID prefix, which depends on it
+func parseRootSpec(spec string, defaults exportRoot) (*exportRoot, error) {
+	r := defaults
+	r.Spec, r.OutputDir, r.IDPrefix = "", "", ""
+	for _, item := range strings.Split(spec, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("setting %q is not key=value", item)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "id":
+			r.Spec = value
+		case "out":
+			r.OutputDir = value
+		case "docs":
+			r.DocsRoot = value
+		case "assets":
+			r.AssetsDir = value
+		case "sidebars":
+			r.Sidebars = value
+		case "idprefix":
+			r.IDPrefix = value
+		default:
+			return nil, fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	if r.Spec == "" || r.OutputDir == "" {
+		return nil, fmt.Errorf("%q needs at least id and out", spec)
+	}
+	return &r, nil
+}
+
+// Resolve the ID and kind of a root and discover the pages below it
+func (r *exportRoot) discover(token string) error {
+	id, err := parseNotionID(r.Spec)
+	if err != nil {
+		return err
+	}
+	kind, err := detectObjectKind(token, id)
+	if err != nil {
+		return fmt.Errorf("looking up %s: %v", id, err)
+	}
+	r.ID, r.Kind = id, kind
+	slog.Info("exporting root", "kind", kind, "id", id, "output", r.OutputDir)
+
+	r.node = &docNode{ID: id, Root: r}
+	r.incomplete = false
+	if kind == objectPage {
+		return processBlocks(token, id, r.node)
+	}
+	return processDatabases(token, kind, id, r.node)
+}
+
+// Make the root's settings the current ones, for the code that renders and
+// writes its pages
+func (r *exportRoot) use() {
+	conf.OutputDir = r.OutputDir
+	conf.DocsRoot = r.DocsRoot
+	conf.AssetsDir = output.AssetsDir(r.AssetsDir)
+}
+
+// Export root the node belongs to, nil for nodes outside of any root
+func (n *docNode) exportRoot() *exportRoot {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	return n.Root
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestParseNotionID(t *testing.T) {
+	const want = "01234567-89ab-cdef-0123-456789abcdef"
+	tests := []struct {
+		in   string
+		want string // empty when an error is expected
+	}{
+		{"0123456789abcdef0123456789abcdef", want},
+		{"01234567-89ab-cdef-0123-456789abcdef", want},
+		{"0123456789ABCDEF0123456789ABCDEF", want},
+		{"  0123456789abcdef0123456789abcdef\n", want},
+		{"https://www.notion.so/acme/Getting-Started-0123456789abcdef0123456789abcdef", want},
+		{"https://www.notion.so/acme/Getting-Started-0123456789abcdef0123456789abcdef?v=fedcba9876543210fedcba9876543210", want},
+		{"https://www.notion.so/acme/Docs-fedcba9876543210fedcba9876543210?p=0123456789abcdef0123456789abcdef&pm=s", want},
+		{"https://acme.notion.site/0123456789abcdef0123456789abcdef", want},
+		{"", ""},
+		{"not-an-id", ""},
+		{"0123456789abcdef0123456789abcde", ""},
+		{"0123456789abcdef0123456789abcdeg", ""},
+		{"https://www.notion.so/acme/Getting-Started", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := parseNotionID(tt.in)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("parseNotionID(%q) = %q, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseNotionID(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
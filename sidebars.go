@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// First line of generated sidebars files, which marks them as safe to remove
+const sidebarsHeader = "// Generated by nosaurus-go, do not edit."
+
+// Sidebar item, marshalled into the generated sidebars file
+type sidebarItem struct {
+	Type        string         `json:"type"`
+	ID          string         `json:"id,omitempty"`
+	Label       string         `json:"label,omitempty"`
+	Collapsible *bool          `json:"collapsible,omitempty"`
+	Collapsed   *bool          `json:"collapsed,omitempty"`
+	ClassName   string         `json:"className,omitempty"`
+	Link        *categoryLink  `json:"link,omitempty"`
+	Items       []*sidebarItem `json:"items,omitempty"`
+}
+
+// Sidebar sort order, parsed from "Property" or "Property:desc"
+type sidebarSort struct {
+	Property   string
+	Descending bool
+}
+
+func parseSidebarSort(spec string) sidebarSort {
+	name, dir, _ := strings.Cut(spec, ":")
+	return sidebarSort{
+		Property:   strings.TrimSpace(name),
+		Descending: strings.EqualFold(strings.TrimSpace(dir), "desc"),
+	}
+}
+
+// Docusaurus doc ID of a page node: its file path relative to the docs
+// directory, without extension. The ID prefix of the node's root gives the
+// root's output directory relative to the docs directory.
+func (n *docNode) docID() string {
+	id := strings.TrimSuffix(filepath.ToSlash(n.filePath()), ".md")
+	if r := n.exportRoot(); r != nil {
+		return path.Join(r.IDPrefix, id)
+	}
+	return id
+}
+
+// Collapsed and collapsible flags of a category, from the page's mapped
+// properties, nil when not set
+func categoryFlags(n *docNode) (collapsed *bool, collapsible *bool) {
+	if n.Page == nil {
+		return nil, nil
+	}
+	if prop, ok := findProperty(*n.Page, roleCollapsed); ok {
+		if value, ok := prop.Bool(); ok {
+			collapsed = &value
+		}
+	}
+	if prop, ok := findProperty(*n.Page, roleCollapsible); ok {
+		if value, ok := prop.Bool(); ok {
+			collapsible = &value
+		}
+	}
+	return collapsed, collapsible
+}
+
+// Children of a node in sidebar order: by the sort property when one is
+// configured, falling back to the order they were found in
+func sortedChildren(n *docNode) []*docNode {
+	children := append([]*docNode{}, n.Children...)
+	by := conf.SidebarSort
+	if by.Property == "" {
+		sort.SliceStable(children, func(i, j int) bool { return children[i].Position < children[j].Position })
+		return children
+	}
+
+	key := func(node *docNode) (float64, string, bool) {
+		if node.Page == nil {
+			return 0, "", false
+		}
+		prop, ok := node.Page.Properties[by.Property]
+		if !ok {
+			return 0, "", false
+		}
+		if f, ok := prop.Float(); ok {
+			return f, "", true
+		}
+		if t, ok := prop.Time(); ok {
+			return float64(t.Unix()), "", true
+		}
+		text := prop.Text()
+		return 0, text, text != ""
+	}
+
+	sort.SliceStable(children, func(i, j int) bool {
+		fi, si, oki := key(children[i])
+		fj, sj, okj := key(children[j])
+		// Nodes without a value go last, in the order they were found
+		if oki != okj {
+			return oki
+		}
+		if !oki || (fi == fj && si == sj) {
+			return children[i].Position < children[j].Position
+		}
+		less := fi < fj || (fi == fj && si < sj)
+		if by.Descending {
+			return !less
+		}
+		return less
+	})
+	return children
+}
+
+// Build the sidebar items for the children of a node
+func sidebarItems(n *docNode) []*sidebarItem {
+	var items []*sidebarItem
+	for _, child := range sortedChildren(n) {
+		if child.Page == nil && len(child.Children) == 0 {
+			continue
+		}
+		if !child.isDir() {
+			items = append(items, &sidebarItem{Type: "doc", ID: child.docID()})
+			continue
+		}
+
+		category := &sidebarItem{
+			Type:  "category",
+			Label: child.Title,
+			Items: sidebarItems(child),
+		}
+		meta := buildCategory(child)
+		category.Collapsed, category.Collapsible = meta.Collapsed, meta.Collapsible
+		category.ClassName = meta.ClassName
+		category.Link = meta.Link
+		items = append(items, category)
+	}
+	return items
+}
+
+// Write a sidebars.js or sidebars.ts file mirroring the exported tree
+func writeSidebars(root *docNode, path string) error {
+	items := sidebarItems(root)
+	if items == nil {
+		items = []*sidebarItem{}
+	}
+	data, err := json.MarshalIndent(map[string][]*sidebarItem{conf.SidebarName: items}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var out string
+	if filepath.Ext(path) == ".ts" {
+		out = fmt.Sprintf(`%s
+import type {SidebarsConfig} from '@docusaurus/plugin-content-docs';
+
+const sidebars: SidebarsConfig = %s;
+
+export default sidebars;
+`, sidebarsHeader, data)
+	} else {
+		out = fmt.Sprintf(`%s
+// @ts-check
+
+/** @type {import('@docusaurus/plugin-content-docs').SidebarsConfig} */
+const sidebars = %s;
+
+module.exports = sidebars;
+`, sidebarsHeader, data)
+	}
+
+	return output.WriteFile(path, []byte(out))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A set of pages that wanted the same URL
+type slugCollision struct {
+	URL     string            // contested URL path, relative to DocsRoot
+	Winner  string            // ID of the page that kept it
+	Renamed map[string]string // new slug by page ID
+}
+
+// Collisions resolved during this export, reported when it finishes
+var slugCollisions []slugCollision
+
+// URL path of a page node relative to DocsRoot. Absolute slugs are used as
+// is, relative ones are resolved against the directory of the page's file,
+// and pages without a slug get Docusaurus' path-based URL.
+func (n *docNode) urlPath() string {
+	dir := filepath.ToSlash(filepath.Dir(n.filePath()))
+	switch {
+	case n.Slug == "":
+		if n.isDir() {
+			return path.Join("/", dir)
+		}
+		return path.Join("/", dir, n.Name)
+	case strings.HasPrefix(n.Slug, "/"):
+		return path.Clean(n.Slug)
+	default:
+		return path.Join("/", dir, n.Slug)
+	}
+}
+
+// Make the slugs of all pages below root unique. Pages contesting a URL are
+// ordered by creation time and then ID, so the oldest page keeps the clean
+// slug on every run regardless of traversal order, and the others get
+// numeric suffixes. Relative slugs only collide within their directory.
+func resolveSlugs(root *docNode) {
+	var nodes []*docNode
+	var walk func(n *docNode)
+	walk = func(n *docNode) {
+		for _, child := range n.Children {
+			if child.Page != nil {
+				nodes = append(nodes, child)
+			}
+			walk(child)
+		}
+	}
+	walk(root)
+
+	byURL := make(map[string][]*docNode)
+	for _, node := range nodes {
+		url := node.urlPath()
+		byURL[url] = append(byURL[url], node)
+	}
+
+	urls := make([]string, 0, len(byURL))
+	for url := range byURL {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	for _, url := range urls {
+		group := byURL[url]
+		if len(group) < 2 {
+			continue
+		}
+
+		sort.SliceStable(group, func(i, j int) bool {
+			a, b := group[i], group[j]
+			// Path-based URLs can't be changed, they win over slugs
+			if (a.Slug == "") != (b.Slug == "") {
+				return a.Slug == ""
+			}
+			if a.Page.CreatedTime != b.Page.CreatedTime {
+				return a.Page.CreatedTime < b.Page.CreatedTime
+			}
+			return a.ID < b.ID
+		})
+
+		collision := slugCollision{URL: url, Winner: group[0].ID, Renamed: make(map[string]string)}
+		for _, node := range group[1:] {
+			base := node.Slug
+			for i := 2; ; i++ {
+				node.Slug = fmt.Sprintf("%s-%d", base, i)
+				if _, taken := byURL[node.urlPath()]; !taken {
+					break
+				}
+			}
+			byURL[node.urlPath()] = []*docNode{node}
+			collision.Renamed[node.ID] = node.Slug
+		}
+		slugCollisions = append(slugCollisions, collision)
+	}
+}
+
+// Log every slug collision resolved during the export
+func reportSlugCollisions() {
+	for _, c := range slugCollisions {
+		slog.Warn("slug collision", "url", c.URL, "page_id", c.Winner, "title", discovered[c.Winner].Title, "path", discovered[c.Winner].filePath())
+
+		ids := make([]string, 0, len(c.Renamed))
+		for id := range c.Renamed {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			slog.Warn("slug renamed", "url", c.URL, "page_id", id, "title", discovered[id].Title, "path", discovered[id].filePath(), "slug", c.Renamed[id])
+		}
+	}
+}
+
+// Title and link of a page. Pages that are part of the export link to the
+// URL their doc is published at, under the docs route of their own root.
+func pageLink(page NotionPage) (string, string) {
+	if node, ok := discovered[page.ID]; ok && node.Name != "" {
+		docsRoot := conf.DocsRoot
+		if root := node.exportRoot(); root != nil {
+			docsRoot = root.DocsRoot
+		}
+		return node.Title, docsRoot + node.urlPath()
+	}
+
+	// Pages outside the export have no doc to link to
+	reportProblem(problemUnresolvedLink, "link to a page outside the export "+page.ID)
+
+	title, slug, _ := extractPageProperties(page)
+	if len(slug) > 0 && slug[0:1] == "/" {
+		slug = conf.DocsRoot + slug
+	}
+	return title, slug
+}
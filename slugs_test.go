@@ -0,0 +1,96 @@
+package main
+
+import "testing"
+
+func TestResolveSlugs(t *testing.T) {
+	type page struct {
+		id, section, title, slug, created string
+	}
+	tests := []struct {
+		name       string
+		pages      []page
+		want       map[string]string // slug by page ID
+		collisions int
+	}{
+		{
+			name: "oldest page keeps the slug",
+			pages: []page{
+				{"a", "", "A", "/intro", "2024-02-01T00:00:00.000Z"},
+				{"b", "", "B", "/intro", "2024-01-01T00:00:00.000Z"},
+			},
+			want:       map[string]string{"a": "/intro-2", "b": "/intro"},
+			collisions: 1,
+		},
+		{
+			name: "ties broken by ID",
+			pages: []page{
+				{"b", "", "B", "/intro", "2024-01-01T00:00:00.000Z"},
+				{"a", "", "A", "/intro", "2024-01-01T00:00:00.000Z"},
+			},
+			want:       map[string]string{"a": "/intro", "b": "/intro-2"},
+			collisions: 1,
+		},
+		{
+			name: "path based URLs win",
+			pages: []page{
+				{"a", "", "Intro", "", "2024-02-01T00:00:00.000Z"},
+				{"b", "", "B", "/intro", "2024-01-01T00:00:00.000Z"},
+			},
+			want:       map[string]string{"a": "", "b": "/intro-2"},
+			collisions: 1,
+		},
+		{
+			name: "relative slugs only collide within their directory",
+			pages: []page{
+				{"a", "Guides", "A", "setup", "2024-01-01T00:00:00.000Z"},
+				{"b", "Reference", "B", "setup", "2024-01-01T00:00:00.000Z"},
+			},
+			want: map[string]string{"a": "setup", "b": "setup"},
+		},
+		{
+			name: "suffixes skip taken URLs",
+			pages: []page{
+				{"a", "", "A", "/x", "2024-01-01T00:00:00.000Z"},
+				{"b", "", "B", "/x", "2024-01-02T00:00:00.000Z"},
+				{"c", "", "C", "/x-2", "2024-01-03T00:00:00.000Z"},
+			},
+			want:       map[string]string{"a": "/x", "b": "/x-3", "c": "/x-2"},
+			collisions: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slugCollisions = nil
+			root := &docNode{ID: "root"}
+			sections := make(map[string]*docNode)
+			nodes := make(map[string]*docNode)
+			for _, p := range tt.pages {
+				parent := root
+				if p.section != "" {
+					if sections[p.section] == nil {
+						sections[p.section] = &docNode{ID: p.section, Title: p.section}
+						root.addChild(sections[p.section])
+					}
+					parent = sections[p.section]
+				}
+				node := &docNode{ID: p.id, Title: p.title, Slug: p.slug, Page: &NotionPage{ID: p.id, CreatedTime: p.created}}
+				parent.addChild(node)
+				nodes[p.id] = node
+			}
+			assignPaths(root, newManifest())
+
+			resolveSlugs(root)
+
+			for id, want := range tt.want {
+				if got := nodes[id].Slug; got != want {
+					t.Errorf("slug of %s = %q, want %q", id, got, want)
+				}
+			}
+			if len(slugCollisions) != tt.collisions {
+				t.Errorf("got %d collisions, want %d", len(slugCollisions), tt.collisions)
+			}
+		})
+	}
+	slugCollisions = nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Template used for page files unless one is given with -template. It
+// reproduces the plain frontmatter and body layout.
+const defaultPageTemplate = `---
+{{ .Frontmatter }}---
+
+{{ .Body }}
+`
+
+// Reference to another page, used for breadcrumbs and children
+type pageRef struct {
+	ID    string
+	Title string
+	Slug  string
+}
+
+// Data available to page templates
+type pageTemplateData struct {
+	Page           NotionPage
+	Properties     map[string]Property
+	Title          string
+	Slug           string
+	Position       float64
+	Frontmatter    string // YAML, without the surrounding --- lines
+	Body           string
+	Breadcrumbs    []pageRef // ancestors, outermost first
+	Children       []pageRef
+	CreatedTime    time.Time
+	LastEditedTime time.Time
+}
+
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"date": func(layout string, t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(layout)
+	},
+	// Text of a property by name, empty when the page doesn't have it
+	"prop": func(name string, props map[string]Property) string {
+		return props[name].Text()
+	},
+}
+
+// Load the page template from path, or the default template if path is empty
+func loadPageTemplate(path string) (*template.Template, error) {
+	text := defaultPageTemplate
+	name := "page"
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+		name = path
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// Render a page file with the configured template
+func renderPageTemplate(data pageTemplateData) (string, error) {
+	var out strings.Builder
+	if err := conf.PageTemplate.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render page template for %s: %v", data.Page.ID, err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A node of the exported document tree. Page nodes are written as markdown
+// files, nodes without a page are plain directories (the export root and
+// child_page blocks).
+type docNode struct {
+	ID       string
+	Page     *NotionPage
+	Title    string
+	Slug     string
+	Position float64
+	Parent   *docNode
+	Children []*docNode
+
+	// File or directory name, assigned by assignPaths
+	Name string
+
+	// Export settings, only set on the top node of a root
+	Root *exportRoot
+}
+
+// Pages already placed in the tree, a page reachable from several places is
+// only exported once, where it was first found
+var discovered = make(map[string]*docNode)
+
+func newPageNode(page NotionPage, parent *docNode, position float64) *docNode {
+	title, slug, _ := extractPageProperties(page)
+	node := &docNode{
+		ID:       page.ID,
+		Page:     &page,
+		Title:    title,
+		Slug:     slug,
+		Position: pagePosition(page, position),
+	}
+	parent.addChild(node)
+	discovered[page.ID] = node
+	return node
+}
+
+func (n *docNode) addChild(child *docNode) {
+	child.Parent = n
+	n.Children = append(n.Children, child)
+}
+
+// Whether the node is written as a directory rather than a single file
+func (n *docNode) isDir() bool {
+	return n.Page == nil || len(n.Children) > 0
+}
+
+// Directory of the node's children, relative to the output root
+func (n *docNode) dirPath() string {
+	if n.Parent == nil {
+		return ""
+	}
+	return filepath.Join(n.Parent.dirPath(), n.Name)
+}
+
+// Markdown file of a page node, relative to the output root
+func (n *docNode) filePath() string {
+	if n.isDir() {
+		return filepath.Join(n.dirPath(), "index.md")
+	}
+	return filepath.Join(n.Parent.dirPath(), n.Name+".md")
+}
+
+// Ancestors of the node as page references, outermost first, excluding the
+// export root
+func (n *docNode) trail() []pageRef {
+	var trail []pageRef
+	for p := n.Parent; p != nil && p.Parent != nil; p = p.Parent {
+		trail = append([]pageRef{{ID: p.ID, Title: p.Title, Slug: p.Slug}}, trail...)
+	}
+	return trail
+}
+
+func (n *docNode) childRefs() []pageRef {
+	var refs []pageRef
+	for _, child := range n.Children {
+		if child.Page != nil {
+			refs = append(refs, pageRef{ID: child.ID, Title: child.Title, Slug: child.Slug})
+		}
+	}
+	return refs
+}
+
+// Add a page and, recursively, its Sub-Items to the tree
+func discoverPage(token string, page NotionPage, parent *docNode, position float64) {
+	if existing, ok := discovered[page.ID]; ok {
+		slog.Debug("page is already exported, skipping", "page_id", page.ID, "title", existing.Title)
+		return
+	}
+	if !matchesFilter(page) {
+		stats.PagesSkipped++
+		slog.Info("page does not match the database filter, skipping", "page_id", page.ID)
+		return
+	}
+
+	node := newPageNode(page, parent, position)
+	emit(eventPageDiscovered)
+
+	_, childPages := extractPageRelations(page)
+	for cPageIndex, child := range childPages {
+		childPage, err := fetchPage(token, child)
+		if err != nil {
+			stats.PagesFailed++
+			node.exportRoot().incomplete = true
+			slog.Error("failed to fetch sub-item", "page_id", child, "parent_id", page.ID, "error", err)
+			continue
+		}
+		discoverPage(token, *childPage, node, float64(cPageIndex+1))
+	}
+}
+
+// Assign every node below root a file or directory name derived from its
+// slug or title. Siblings are named in page ID order so that, when names
+// collide, the same page gets the same name on every run. Pages keep the name
+// they were exported under last time if it is still free.
+func assignPaths(root *docNode, previous *manifest) {
+	siblings := append([]*docNode{}, root.Children...)
+	sort.SliceStable(siblings, func(i, j int) bool { return siblings[i].ID < siblings[j].ID })
+
+	// index.md holds the page of a directory
+	used := map[string]bool{"index": true}
+
+	// Names from the previous export first, so renaming one page doesn't
+	// shuffle the suffixes of its siblings
+	for _, node := range siblings {
+		name := previous.nameOf(node.ID)
+		if isNameFor(name, nodeName(node.Slug, node.Title, node.ID)) && !used[name] {
+			node.Name = name
+			used[name] = true
+		}
+	}
+
+	for _, node := range siblings {
+		if node.Name != "" {
+			continue
+		}
+		base := nodeName(node.Slug, node.Title, node.ID)
+		name := base
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		node.Name = name
+		used[name] = true
+	}
+
+	for _, node := range root.Children {
+		assignPaths(node, previous)
+	}
+}
+
+// Whether name is base or base with a numeric collision suffix
+func isNameFor(name string, base string) bool {
+	if name == base {
+		return true
+	}
+	suffix := strings.TrimPrefix(name, base+"-")
+	if suffix == name || suffix == "" {
+		return false
+	}
+	for _, r := range suffix {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Write the markdown files of every page below node
+func writeTree(token string, outputDir string, node *docNode, written *manifest, previous *manifest) {
+	for _, child := range node.Children {
+		if child.Page == nil && len(child.Children) == 0 {
+			continue
+		}
+		if child.isDir() {
+			dir := filepath.Join(outputDir, child.dirPath())
+			if err := output.MkdirAll(dir); err != nil {
+				slog.Error("failed to create directory", "path", dir, "error", err)
+				continue
+			}
+		}
+
+		// Directories of child_page blocks have no page of their own
+		if child.Page == nil {
+			if err := writeCategory(outputDir, child); err != nil {
+				slog.Error("failed to write category", "id", child.ID, "title", child.Title, "error", err)
+			}
+		}
+
+		if child.Page != nil {
+			if entry, ok := previous.upToDate(outputDir, child); conf.Incremental && ok {
+				// Unchanged since the previous export, keep its file and assets
+				for _, rel := range entry.Assets {
+					markAssetReferenced(rel)
+				}
+				written.Pages[child.ID] = entry
+				stats.PagesUnchanged++
+			} else if err := writeMarkdown(token, outputDir, child); err != nil {
+				stats.PagesFailed++
+				slog.Error("failed to write page", "page_id", child.ID, "title", child.Title, "error", err)
+			} else {
+				written.add(child, assets.page)
+				stats.PagesWritten++
+			}
+			emit(eventPageRendered)
+		}
+
+		writeTree(token, outputDir, child, written, previous)
+	}
+}
+
+// Write the markdown file of a page node, along with the _category_.json of
+// its directory when it has children
+func writeMarkdown(token string, outputDir string, node *docNode) error {
+	defer beginPage(node)()
+	assets.page = nil
+	markdown, err := pageToMarkdown(token, node)
+	if err != nil {
+		return err
+	}
+
+	if len(node.Children) > 0 {
+		if err := writeCategory(outputDir, node); err != nil {
+			pageLog.Error("failed to write category", "error", err)
+		}
+	}
+
+	return output.WriteFile(filepath.Join(outputDir, node.filePath()), []byte(markdown))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAssignPaths(t *testing.T) {
+	type page struct{ id, title string }
+	tests := []struct {
+		name     string
+		pages    []page
+		previous map[string]string // previous file by page ID
+		want     map[string]string // name by page ID
+	}{
+		{
+			name:  "unique",
+			pages: []page{{"a", "Intro"}, {"b", "Setup"}},
+			want:  map[string]string{"a": "intro", "b": "setup"},
+		},
+		{
+			name:  "collisions suffixed in ID order",
+			pages: []page{{"c", "Intro"}, {"a", "Intro"}, {"b", "Intro"}},
+			want:  map[string]string{"a": "intro", "b": "intro-2", "c": "intro-3"},
+		},
+		{
+			name:  "index is reserved",
+			pages: []page{{"a", "Index"}},
+			want:  map[string]string{"a": "index-2"},
+		},
+		{
+			name:     "previous names are kept",
+			pages:    []page{{"a", "Intro"}, {"b", "Intro"}},
+			previous: map[string]string{"b": "intro.md", "a": "intro-2/index.md"},
+			want:     map[string]string{"a": "intro-2", "b": "intro"},
+		},
+		{
+			name:     "renamed pages get a new name",
+			pages:    []page{{"a", "Overview"}},
+			previous: map[string]string{"a": "intro.md"},
+			want:     map[string]string{"a": "overview"},
+		},
+		{
+			name:     "names taken by other pages aren't reused",
+			pages:    []page{{"a", "Intro"}, {"b", "Intro"}},
+			previous: map[string]string{"a": "intro.md", "b": "intro.md"},
+			want:     map[string]string{"a": "intro", "b": "intro-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := &docNode{ID: "root"}
+			for _, p := range tt.pages {
+				root.addChild(&docNode{ID: p.id, Title: p.title, Page: &NotionPage{ID: p.id}})
+			}
+			previous := newManifest()
+			for id, file := range tt.previous {
+				previous.Pages[id] = manifestPage{Path: file}
+			}
+
+			assignPaths(root, previous)
+
+			for _, node := range root.Children {
+				if node.Name != tt.want[node.ID] {
+					t.Errorf("page %s named %q, want %q", node.ID, node.Name, tt.want[node.ID])
+				}
+			}
+		})
+	}
+}
+
+func TestAssignPathsNested(t *testing.T) {
+	root := &docNode{ID: "root"}
+	section := &docNode{ID: "s", Title: "Guides"}
+	root.addChild(section)
+	page := &docNode{ID: "p", Title: "Intro", Page: &NotionPage{ID: "p"}}
+	section.addChild(page)
+	child := &docNode{ID: "c", Title: "Details", Page: &NotionPage{ID: "c"}}
+	page.addChild(child)
+
+	assignPaths(root, newManifest())
+
+	tests := []struct {
+		node *docNode
+		want string
+	}{
+		{page, "guides/intro/index.md"},
+		{child, "guides/intro/details.md"},
+	}
+	for _, tt := range tests {
+		if got := tt.node.filePath(); got != filepath.FromSlash(tt.want) {
+			t.Errorf("file of %s = %q, want %q", tt.node.ID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rafayhingoro/nosaurus-go/cache"
+)
+
+// Most recently edited page or database shared with the integration, zero
+// time when there is none. Search results aren't cached.
+func latestEdit(token string) (time.Time, error) {
+	url := "https://api.notion.com/v1/search"
+	query := `{"sort":{"direction":"descending","timestamp":"last_edited_time"},"page_size":1}`
+
+	client := &http.Client{}
+	req, err := http.NewRequest("POST", url, strings.NewReader(query))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("Notion-Version", "2022-06-28")
+	req.Header.Add("Content-Type", "application/json")
+
+	stats.APICalls++
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if resp.StatusCode == 429 {
+		stats.APIRetries++
+		emitRateLimited(3 * time.Second)
+		slog.Warn("rate limited, retrying", "url", url, "wait", 3*time.Second)
+		time.Sleep(3 * time.Second)
+		return latestEdit(token)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("searching for edits: %s: %s", resp.Status, body)
+	}
+
+	var response struct {
+		Results []struct {
+			LastEditedTime string `json:"last_edited_time"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return time.Time{}, err
+	}
+	if len(response.Results) == 0 {
+		return time.Time{}, nil
+	}
+	edited, _ := parseNotionTime(response.Results[0].LastEditedTime)
+	return edited, nil
+}
+
+// Forget the pages, API responses and counts of the previous export
+func resetExport() {
+	discovered = make(map[string]*docNode)
+	slugCollisions = nil
+	apiCache = cache.NewCache()
+	assets.referenced = nil
+	stats = newRunStats()
+}
+
+// Sync the roots, then keep syncing whenever something shared with the
+// integration was edited, checking every s.Interval until interrupted.
+// Pages outside the roots trigger a sync too, which only renders the pages
+// of the roots that changed.
+func runWatch(s *settings) {
+	requireToken(s)
+	requireRoots(s)
+	if s.DryRun {
+		fatal("watch can't be combined with -dry-run")
+	}
+	if s.Interval <= 0 {
+		fatal("-poll-interval must be positive")
+	}
+
+	var synced time.Time
+	for {
+		latest, err := latestEdit(s.Token)
+		if err != nil {
+			slog.Error("failed to check for edits", "error", err)
+		}
+
+		// Edit times are rounded down to the minute, edits are only known
+		// to be exported by a sync started after their minute was over
+		if synced.IsZero() || err == nil && synced.Before(latest.Add(time.Minute)) {
+			synced = time.Now()
+			resetExport()
+			code := export(s, true)
+			if code != 0 {
+				slog.Warn("sync finished with problems, still watching", "exit_code", code)
+			}
+			// Pages that failed or couldn't be discovered are tried again
+			// on the next check
+			if code == exitFailed {
+				synced = time.Time{}
+			}
+			slog.Info("watching for edits", "interval", s.Interval)
+		}
+
+		time.Sleep(s.Interval)
+	}
+}